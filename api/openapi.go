@@ -0,0 +1,11 @@
+// Package api holds the published API definitions: the OpenAPI document of
+// the HTTP API, and the protobuf definitions of the gRPC API under wallet/.
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 document describing every HTTP route. It is
+// served at /openapi.json and requests are validated against it.
+//
+//go:embed openapi.json
+var OpenAPI []byte
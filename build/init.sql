@@ -1,6 +1,5 @@
 CREATE TABLE IF NOT EXISTS users (
-    id BIGINT PRIMARY KEY,
-    balance NUMERIC(12, 2) NOT NULL DEFAULT 0.00
+    id BIGINT PRIMARY KEY
 );
 
 CREATE TABLE IF NOT EXISTS transactions (
@@ -8,13 +7,327 @@ CREATE TABLE IF NOT EXISTS transactions (
     user_id BIGINT NOT NULL REFERENCES users(id),
     amount NUMERIC(12, 2) NOT NULL,
     state TEXT NOT NULL CHECK (state IN ('win', 'lose')),
-    source_type TEXT NOT NULL CHECK (source_type IN ('game', 'server', 'payment')),
+    source_type TEXT NOT NULL CHECK (source_type IN ('game', 'server', 'payment', 'transfer')),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
--- Seed users with zero balance
-INSERT INTO users (id, balance) VALUES
-(1, 0.00),
-(2, 0.00),
-(3, 0.00)
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS balance_after NUMERIC(12, 2);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS request_fingerprint TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reverses_transaction_id TEXT
+UNIQUE REFERENCES transactions(transaction_id);
+
+-- Round IDs come from game providers and are shared by the players of a
+-- multiplayer round, so rounds are keyed per user
+CREATE TABLE IF NOT EXISTS rounds (
+    round_id TEXT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    game_id TEXT,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'settled')),
+    stake NUMERIC(12, 2) NOT NULL DEFAULT 0.00,
+    payout NUMERIC(12, 2) NOT NULL DEFAULT 0.00,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    settled_at TIMESTAMP,
+    PRIMARY KEY (user_id, round_id)
+);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS round_id TEXT;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'transactions_round_fkey') THEN
+        ALTER TABLE transactions ADD CONSTRAINT transactions_round_fkey
+            FOREIGN KEY (user_id, round_id) REFERENCES rounds(user_id, round_id);
+    END IF;
+END $$;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS game_id TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS end_round BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS transactions_round_id_idx ON transactions (round_id);
+
+CREATE TABLE IF NOT EXISTS reservations (
+    reservation_id TEXT PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    status TEXT NOT NULL DEFAULT 'held' CHECK (status IN ('held', 'captured', 'released', 'expired')),
+    source_type TEXT NOT NULL CHECK (source_type IN ('game', 'server', 'payment')),
+    transaction_id TEXT REFERENCES transactions(transaction_id),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS reservations_held_expiry_idx ON reservations (expires_at) WHERE status = 'held';
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+CHECK (status IN ('active', 'suspended', 'closed'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+CREATE SEQUENCE IF NOT EXISTS users_id_seq OWNED BY users.id;
+ALTER TABLE users ALTER COLUMN id SET DEFAULT nextval('users_id_seq');
+SELECT setval('users_id_seq', GREATEST(
+    (SELECT COALESCE(MAX(id), 0) FROM users),
+    (SELECT last_value FROM users_id_seq),
+    1));
+
+CREATE INDEX IF NOT EXISTS transactions_user_history_idx
+ON transactions (user_id, created_at DESC, transaction_id DESC);
+
+-- Seed users
+INSERT INTO users (id) VALUES
+(1),
+(2),
+(3)
 ON CONFLICT (id) DO NOTHING;
+
+-- ISO-4217 currencies; Money holds two decimal places at most
+CREATE TABLE IF NOT EXISTS currencies (
+    code CHAR(3) PRIMARY KEY,
+    minor_units SMALLINT NOT NULL CHECK (minor_units BETWEEN 0 AND 2)
+);
+
+INSERT INTO currencies (code, minor_units) VALUES
+('EUR', 2), ('USD', 2), ('GBP', 2), ('CHF', 2), ('SEK', 2), ('NOK', 2), ('DKK', 2), ('PLN', 2),
+('CAD', 2), ('AUD', 2), ('NZD', 2), ('BRL', 2), ('MXN', 2), ('ZAR', 2), ('INR', 2), ('SGD', 2),
+('JPY', 0), ('KRW', 0), ('ISK', 0)
+ON CONFLICT (code) DO NOTHING;
+
+-- One wallet per user and currency
+CREATE TABLE IF NOT EXISTS wallets (
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    currency CHAR(3) NOT NULL REFERENCES currencies(code),
+    balance NUMERIC(12, 2) NOT NULL DEFAULT 0.00,
+    reserved NUMERIC(12, 2) NOT NULL DEFAULT 0.00,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, currency)
+);
+
+INSERT INTO wallets (user_id, currency) VALUES
+(1, 'EUR'),
+(2, 'EUR'),
+(3, 'EUR')
+ON CONFLICT (user_id, currency) DO NOTHING;
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'EUR'
+REFERENCES currencies(code);
+ALTER TABLE rounds ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'EUR'
+REFERENCES currencies(code);
+ALTER TABLE reservations ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'EUR'
+REFERENCES currencies(code);
+
+-- Cash and bonus sub-balances; bonus converts to cash once wagered
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS bonus NUMERIC(12, 2) NOT NULL DEFAULT 0.00 CHECK (bonus >= 0);
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS wagering_required NUMERIC(12, 2) NOT NULL DEFAULT 0.00;
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS wagering_progress NUMERIC(12, 2) NOT NULL DEFAULT 0.00;
+-- Part of reserved held by withdrawals, which hold cash only
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS reserved_cash NUMERIC(12, 2) NOT NULL DEFAULT 0.00 CHECK (reserved_cash >= 0);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS cash_amount NUMERIC(12, 2);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS bonus_amount NUMERIC(12, 2);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS bonus_grant BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS wagering_requirement NUMERIC(12, 2);
+
+-- Responsible-gambling limits; raises and removals wait in pending_amount
+CREATE TABLE IF NOT EXISTS user_limits (
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    currency CHAR(3) NOT NULL REFERENCES currencies(code),
+    limit_type TEXT NOT NULL CHECK (limit_type IN ('deposit', 'loss', 'wager')),
+    period TEXT NOT NULL CHECK (period IN ('daily', 'weekly', 'monthly')),
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    pending_amount NUMERIC(12, 2) CHECK (pending_amount > 0),
+    pending_effective_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, currency, limit_type, period)
+);
+
+-- Self-exclusions and time-outs; never updated, so they are also the history
+CREATE TABLE IF NOT EXISTS exclusions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    exclusion_type TEXT NOT NULL CHECK (exclusion_type IN ('self_exclusion', 'time_out')),
+    reason TEXT,
+    actor TEXT NOT NULL DEFAULT 'api',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ends_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS exclusions_user_id_idx ON exclusions (user_id, created_at DESC);
+
+-- Transfers between users; both sides are 'transfer' transactions linked by transfer_id
+CREATE TABLE IF NOT EXISTS transfers (
+    transfer_id TEXT PRIMARY KEY,
+    from_user_id BIGINT NOT NULL REFERENCES users(id),
+    to_user_id BIGINT NOT NULL REFERENCES users(id),
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    currency CHAR(3) NOT NULL REFERENCES currencies(code),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (from_user_id <> to_user_id)
+);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS transfer_id TEXT REFERENCES transfers(transfer_id);
+
+-- Transactions accepted asynchronously, applied by workers in per-user FIFO order
+CREATE TABLE IF NOT EXISTS transaction_queue (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id TEXT NOT NULL UNIQUE,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    source_type TEXT NOT NULL,
+    request JSONB NOT NULL,
+    request_fingerprint TEXT NOT NULL,
+    callback_url TEXT,
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'processing', 'done', 'failed')),
+    http_status INT,
+    response JSONB,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS transaction_queue_pending_idx ON transaction_queue (user_id, id)
+WHERE status IN ('queued', 'processing');
+
+-- Wallet balances corrected by reconciliation, kept for audit
+CREATE TABLE IF NOT EXISTS balance_corrections (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    currency CHAR(3) NOT NULL REFERENCES currencies(code),
+    previous_balance NUMERIC(12, 2) NOT NULL,
+    corrected_balance NUMERIC(12, 2) NOT NULL,
+    ledger_balance NUMERIC(12, 2) NOT NULL,
+    actor TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Every balance change with the balance before and after; append-only
+CREATE TABLE IF NOT EXISTS balance_audit (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    currency CHAR(3) NOT NULL REFERENCES currencies(code),
+    previous_balance NUMERIC(12, 2) NOT NULL,
+    new_balance NUMERIC(12, 2) NOT NULL,
+    actor TEXT NOT NULL,
+    source_type TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    transaction_id TEXT REFERENCES transactions(transaction_id),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS balance_audit_user_id_idx ON balance_audit (user_id, id DESC);
+
+CREATE OR REPLACE FUNCTION reject_balance_audit_change() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'balance_audit is append-only';
+END $$ LANGUAGE plpgsql;
+
+CREATE TRIGGER balance_audit_append_only BEFORE UPDATE OR DELETE ON balance_audit
+FOR EACH ROW EXECUTE FUNCTION reject_balance_audit_change();
+
+-- Domain events published by the outbox relay; published_at is set once a sink accepted one
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id),
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_unpublished_idx ON outbox_events (id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_events_user_idx ON outbox_events (user_id, id);
+
+-- Webhook subscriptions fed from the outbox, their delivery log and dead letters
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    user_id BIGINT REFERENCES users(id),
+    threshold NUMERIC(12, 2),
+    currency CHAR(3) REFERENCES currencies(code),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id BIGINT NOT NULL REFERENCES outbox_events(id),
+    event_type TEXT NOT NULL,
+    body TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_status_code INT,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (webhook_id, event_id, event_type)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_log_idx ON webhook_deliveries (webhook_id, id DESC);
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id BIGINT NOT NULL UNIQUE,
+    webhook_id BIGINT NOT NULL,
+    url TEXT NOT NULL,
+    event_id BIGINT NOT NULL,
+    event_type TEXT NOT NULL,
+    body TEXT NOT NULL,
+    attempts INT NOT NULL,
+    last_status_code INT,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Double-entry ledger; wallet balances are a projection of wallet postings
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id BIGSERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    kind TEXT NOT NULL CHECK (kind IN ('user_wallet', 'house')),
+    user_id BIGINT REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE ledger_accounts ADD COLUMN IF NOT EXISTS currency CHAR(3) REFERENCES currencies(code);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id TEXT REFERENCES transactions(transaction_id),
+    description TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id BIGINT NOT NULL REFERENCES journal_entries(id),
+    account_id BIGINT NOT NULL REFERENCES ledger_accounts(id),
+    direction TEXT NOT NULL CHECK (direction IN ('debit', 'credit')),
+    amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0)
+);
+CREATE INDEX IF NOT EXISTS postings_account_id_idx ON postings (account_id);
+CREATE INDEX IF NOT EXISTS postings_entry_id_idx ON postings (entry_id);
+
+CREATE OR REPLACE FUNCTION assert_journal_entry_balanced() RETURNS TRIGGER AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM postings p
+        JOIN ledger_accounts a ON a.id = p.account_id
+        WHERE p.entry_id = NEW.entry_id
+        GROUP BY a.currency
+        HAVING SUM(CASE p.direction WHEN 'debit' THEN p.amount ELSE -p.amount END) <> 0
+    ) THEN
+        RAISE EXCEPTION 'journal entry % is not balanced', NEW.entry_id;
+    END IF;
+    RETURN NULL;
+END $$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced AFTER INSERT ON postings
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW EXECUTE FUNCTION assert_journal_entry_balanced();
+
+INSERT INTO ledger_accounts (code, kind, currency) VALUES
+('house:game_revenue:EUR', 'house', 'EUR'),
+('house:payment_clearing:EUR', 'house', 'EUR'),
+('house:server_adjustments:EUR', 'house', 'EUR'),
+('house:opening_balance:EUR', 'house', 'EUR'),
+('house:promotions:EUR', 'house', 'EUR'),
+('house:transfers:EUR', 'house', 'EUR'),
+('house:reconciliation:EUR', 'house', 'EUR')
+ON CONFLICT (code) DO NOTHING;
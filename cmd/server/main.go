@@ -2,21 +2,27 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
-	"github.com/gorilla/mux"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-
+	"entain-app/api"
+	"entain-app/configs"
 	"entain-app/internal/db"
+	"entain-app/internal/server"
 	"entain-app/internal/user"
 	"entain-app/pkg/utils"
 )
 
 func main() {
+	// Subcommands run once and exit instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(os.Args[2:]))
+	}
+
 	// Step 0: Initialize structured logger
 	utils.InitLogger()
 	utils.Logger.Info("Logger initialized")
@@ -29,34 +35,32 @@ func main() {
 	db.RunMigrations()
 	utils.Logger.Info("Migrations completed")
 
-	// Step 3: Setup HTTP router
-	r := mux.NewRouter()
+	// Background jobs, stopped on shutdown
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	user.StartReservationSweeper(bgCtx)
+	user.StartTransactionWorkers(bgCtx)
+	user.StartReconciler(bgCtx)
+	sink, err := user.ConfiguredSink()
+	if err != nil {
+		utils.Logger.WithError(err).Fatal("Failed to open event sink")
+	}
+	user.StartOutboxRelay(bgCtx, sink)
+	user.StartWebhookWorkers(bgCtx)
+	if err := user.StartBalanceListener(bgCtx); err != nil {
+		utils.Logger.WithError(err).Fatal("Failed to start balance listener")
+	}
 
-	// Main API routes
-	r.HandleFunc("/user/{userId}/transaction", user.HandleTransaction).Methods("POST")
-	r.HandleFunc("/user/{userId}/balance", user.HandleBalance).Methods("GET")
+	// Step 3: Setup HTTP router
+	r := server.NewRouter()
+	validate, err := utils.NewOpenAPIValidator(api.OpenAPI)
+	if err != nil {
+		utils.Logger.WithError(err).Fatal("Failed to load OpenAPI document")
+	}
 
-	// Health check route
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		if err := db.DB.Ping(); err != nil {
-			http.Error(w, `{"status":"unhealthy","database":"disconnected"}`, http.StatusServiceUnavailable)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"status":"ok","database":"connected"}`))
-	}).Methods("GET")
-
-	// Prometheus metrics endpoint
-	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
-
-	// Root route for browser base URL access
-	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Entain API is running. See /health or /user/{id}/balance"))
-	}).Methods("GET")
-	
-	// Step 4: Apply middleware stack (panic recovery → logging → rate limiting)
+	// Step 4: Apply middleware stack (request validation → panic recovery → logging → rate limiting)
 	stacked := utils.ChainMiddlewares(r,
+		validate,
 		utils.RecoverMiddleware,
 		utils.LoggingMiddleware,
 		utils.RateLimitMiddleware,
@@ -76,11 +80,26 @@ func main() {
 		}
 	}()
 
+	// gRPC API on its own port
+	grpcCfg := configs.LoadGRPCConfig()
+	grpcSrv := user.NewGRPCServer()
+	go func() {
+		lis, err := net.Listen("tcp", grpcCfg.Addr)
+		if err != nil {
+			utils.Logger.WithError(err).Fatal("gRPC listen error")
+		}
+		utils.Logger.Info("gRPC server started on " + grpcCfg.Addr)
+		if err := grpcSrv.Serve(lis); err != nil {
+			utils.Logger.WithError(err).Fatal("gRPC serve error")
+		}
+	}()
+
 	// Step 7: Wait for SIGINT/SIGTERM
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 	utils.Logger.Info("Gracefully shutting down...")
+	stopBackground()
 
 	// Step 8: Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -89,6 +108,7 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		utils.Logger.WithError(err).Fatal("Server forced to shutdown")
 	}
+	grpcSrv.GracefulStop()
 
 	utils.Logger.Info("Server exited cleanly")
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+	"entain-app/pkg/utils"
+)
+
+// runReconcile checks every wallet balance against the transaction log once
+// and prints the report as JSON. It exits non-zero on failure or when drift
+// is left unrepaired.
+//
+//	server reconcile [-repair]
+func runReconcile(args []string) int {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "correct drifting balances and record each correction")
+	fs.Parse(args)
+
+	// Logs go to stderr so stdout carries only the report
+	utils.InitLogger()
+	utils.Logger.SetOutput(os.Stderr)
+	db.InitDB()
+	db.RunMigrations()
+
+	report, err := user.Reconcile(*repair, "reconcile-cli")
+	if err != nil {
+		utils.Logger.WithError(err).Error("Reconciliation failed")
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return 1
+	}
+	for _, d := range report.Drifts {
+		if !d.Repaired {
+			return 1
+		}
+	}
+	return 0
+}
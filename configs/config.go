@@ -3,6 +3,10 @@ package configs
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type DBConfig struct {
@@ -31,9 +35,213 @@ func (c *DBConfig) DSN() string {
 		c.User, c.Password, c.Host, c.Port, c.Name)
 }
 
+// ReservationConfig controls authorize/capture/release fund holds.
+type ReservationConfig struct {
+	DefaultTTL    time.Duration
+	MaxTTL        time.Duration
+	SweepInterval time.Duration
+}
+
+func LoadReservationConfig() *ReservationConfig {
+	return &ReservationConfig{
+		DefaultTTL:    getEnvDuration("RESERVATION_DEFAULT_TTL", 5*time.Minute),
+		MaxTTL:        getEnvDuration("RESERVATION_MAX_TTL", 24*time.Hour),
+		SweepInterval: getEnvDuration("RESERVATION_SWEEP_INTERVAL", 30*time.Second),
+	}
+}
+
+// WalletConfig controls multi-currency wallets.
+type WalletConfig struct {
+	DefaultCurrency string // ISO-4217 code used when a request names none
+}
+
+func LoadWalletConfig() *WalletConfig {
+	currency := strings.ToUpper(getEnv("DEFAULT_CURRENCY", "EUR"))
+	if !currencyCode.MatchString(currency) {
+		currency = "EUR"
+	}
+	return &WalletConfig{DefaultCurrency: currency}
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Orders in which a lose spends the cash and bonus sub-balances.
+const (
+	CashFirst  = "cash_first"
+	BonusFirst = "bonus_first"
+)
+
+// BonusConfig controls how bonus funds are spent.
+type BonusConfig struct {
+	ConsumptionOrder string // CashFirst or BonusFirst
+}
+
+func LoadBonusConfig() *BonusConfig {
+	order := strings.ToLower(getEnv("BONUS_CONSUMPTION_ORDER", CashFirst))
+	if order != BonusFirst {
+		order = CashFirst
+	}
+	return &BonusConfig{ConsumptionOrder: order}
+}
+
+// LimitConfig controls responsible-gambling limits.
+type LimitConfig struct {
+	CoolingOff time.Duration // delay before a raised or removed limit applies
+}
+
+func LoadLimitConfig() *LimitConfig {
+	return &LimitConfig{
+		CoolingOff: getEnvDuration("LIMIT_COOLING_OFF", 24*time.Hour),
+	}
+}
+
+// AsyncConfig controls the queue behind asynchronous transactions.
+type AsyncConfig struct {
+	Workers         int
+	PollInterval    time.Duration // idle workers check the queue this often
+	Lease           time.Duration // a claimed item not finished by then is retried
+	CallbackTimeout time.Duration
+	CallbackHosts   []string // hosts a Callback-URL may point at; none disables callbacks
+}
+
+func LoadAsyncConfig() *AsyncConfig {
+	return &AsyncConfig{
+		Workers:         getEnvInt("ASYNC_WORKERS", 4),
+		PollInterval:    getEnvDuration("ASYNC_POLL_INTERVAL", 500*time.Millisecond),
+		Lease:           getEnvDuration("ASYNC_LEASE", time.Minute),
+		CallbackTimeout: getEnvDuration("ASYNC_CALLBACK_TIMEOUT", 5*time.Second),
+		CallbackHosts:   getEnvList("ASYNC_CALLBACK_HOSTS"),
+	}
+}
+
+// ReconcileConfig controls the job that checks wallet balances against the
+// transaction log.
+type ReconcileConfig struct {
+	Interval time.Duration
+	Repair   bool // correct drifting balances instead of only reporting them
+}
+
+func LoadReconcileConfig() *ReconcileConfig {
+	return &ReconcileConfig{
+		Interval: getEnvDuration("RECONCILE_INTERVAL", time.Hour),
+		Repair:   getEnvBool("RECONCILE_REPAIR", false),
+	}
+}
+
+// Sinks the outbox relay can publish domain events to.
+const (
+	SinkFile = "file" // NDJSON lines appended to OutboxConfig.File
+	SinkNone = "none" // events only reach webhooks
+)
+
+// OutboxConfig controls the relay that publishes domain events.
+type OutboxConfig struct {
+	Sink         string
+	File         string
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+func LoadOutboxConfig() *OutboxConfig {
+	sink := strings.ToLower(getEnv("OUTBOX_SINK", SinkFile))
+	if sink != SinkNone {
+		sink = SinkFile
+	}
+	return &OutboxConfig{
+		Sink:         sink,
+		File:         getEnv("OUTBOX_FILE", "events.ndjson"),
+		PollInterval: getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		BatchSize:    getEnvInt("OUTBOX_BATCH_SIZE", 100),
+	}
+}
+
+// WebhookConfig controls delivery of webhook callbacks.
+type WebhookConfig struct {
+	Workers      int
+	PollInterval time.Duration
+	Timeout      time.Duration // per delivery attempt
+	MaxAttempts  int           // attempts before a delivery is dead-lettered
+	BackoffBase  time.Duration // delay after the first failure, doubled after each
+	BackoffMax   time.Duration
+}
+
+func LoadWebhookConfig() *WebhookConfig {
+	return &WebhookConfig{
+		Workers:      getEnvInt("WEBHOOK_WORKERS", 4),
+		PollInterval: getEnvDuration("WEBHOOK_POLL_INTERVAL", time.Second),
+		Timeout:      getEnvDuration("WEBHOOK_TIMEOUT", 5*time.Second),
+		MaxAttempts:  getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		BackoffBase:  getEnvDuration("WEBHOOK_BACKOFF_BASE", 5*time.Second),
+		BackoffMax:   getEnvDuration("WEBHOOK_BACKOFF_MAX", time.Hour),
+	}
+}
+
+// BalanceStreamConfig controls the server-sent balance event streams.
+type BalanceStreamConfig struct {
+	Heartbeat time.Duration // idle time before a keep-alive comment is sent
+}
+
+func LoadBalanceStreamConfig() *BalanceStreamConfig {
+	return &BalanceStreamConfig{
+		Heartbeat: getEnvDuration("BALANCE_STREAM_HEARTBEAT", 15*time.Second),
+	}
+}
+
+// GRPCConfig controls the gRPC API served next to the HTTP one.
+type GRPCConfig struct {
+	Addr string
+}
+
+func LoadGRPCConfig() *GRPCConfig {
+	return &GRPCConfig{
+		Addr: getEnv("GRPC_ADDR", ":9090"),
+	}
+}
+
 func getEnv(key, fallback string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
 	}
 	return fallback
 }
+
+// getEnvDuration parses values such as "30s" or "5m", falling back on error.
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+// getEnvInt parses a positive integer, falling back on error.
+func getEnvInt(key string, fallback int) int {
+	if val := os.Getenv(key); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			return n
+		}
+	}
+	return fallback
+}
+
+// getEnvList splits a comma-separated value, dropping empty items.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvBool parses values such as "true" or "0", falling back on error.
+func getEnvBool(key string, fallback bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
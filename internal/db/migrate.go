@@ -1,14 +1,20 @@
 package db
 
 import (
+	"fmt"
+
+	"entain-app/configs"
 	"entain-app/pkg/utils"
 )
 
 func RunMigrations() {
+	// Validated as a three-letter code by configs, so safe to inline
+	defaultCurrency := configs.LoadWalletConfig().DefaultCurrency
+
+	// Balances live in wallets, one per user and currency.
 	createUserTable := `
 	CREATE TABLE IF NOT EXISTS users (
-		id BIGINT PRIMARY KEY,
-		balance NUMERIC(12, 2) NOT NULL DEFAULT 0.00
+		id BIGINT PRIMARY KEY
 	);`
 
 	createTransactionTable := `
@@ -21,12 +27,499 @@ func RunMigrations() {
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);`
 
+	// Balance left behind by each transaction, for status lookups.
+	addTransactionBalanceAfter := `
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS balance_after NUMERIC(12, 2);`
+
+	// Hash of the original request, to tell replays from conflicting reuse.
+	addTransactionFingerprint := `
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS request_fingerprint TEXT;`
+
+	// Links a compensating entry to the transaction it reverses; the unique
+	// constraint allows at most one reversal per transaction.
+	addTransactionReversal := `
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reverses_transaction_id TEXT
+	UNIQUE REFERENCES transactions(transaction_id);`
+
+	// Game rounds link a stake (lose) to its later payout (win). Round IDs
+	// come from game providers and are shared by every player of a
+	// multiplayer round, so a round is keyed per user.
+	createRoundTable := `
+	CREATE TABLE IF NOT EXISTS rounds (
+		round_id TEXT NOT NULL,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		game_id TEXT,
+		status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'settled')),
+		stake NUMERIC(12, 2) NOT NULL DEFAULT 0.00,
+		payout NUMERIC(12, 2) NOT NULL DEFAULT 0.00,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		settled_at TIMESTAMP,
+		PRIMARY KEY (user_id, round_id)
+	);`
+
+	addTransactionRound := `
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS round_id TEXT;
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS game_id TEXT;
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS end_round BOOLEAN NOT NULL DEFAULT FALSE;
+	CREATE INDEX IF NOT EXISTS transactions_round_id_idx ON transactions (round_id);`
+
+	// Rounds were first keyed on round_id alone; move them and the
+	// transactions referencing them to (user_id, round_id).
+	keyRoundsByUser := `
+	DO $$ BEGIN
+		IF EXISTS (
+			SELECT 1 FROM pg_constraint
+			WHERE conname = 'rounds_pkey' AND pg_get_constraintdef(oid) = 'PRIMARY KEY (round_id)'
+		) THEN
+			ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_round_id_fkey;
+			ALTER TABLE rounds DROP CONSTRAINT rounds_pkey;
+			ALTER TABLE rounds ADD PRIMARY KEY (user_id, round_id);
+		END IF;
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'transactions_round_fkey') THEN
+			ALTER TABLE transactions ADD CONSTRAINT transactions_round_fkey
+				FOREIGN KEY (user_id, round_id) REFERENCES rounds(user_id, round_id);
+		END IF;
+	END $$;`
+
+	createReservationTable := `
+	CREATE TABLE IF NOT EXISTS reservations (
+		reservation_id TEXT PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+		status TEXT NOT NULL DEFAULT 'held' CHECK (status IN ('held', 'captured', 'released', 'expired')),
+		source_type TEXT NOT NULL CHECK (source_type IN ('game', 'server', 'payment')),
+		transaction_id TEXT REFERENCES transactions(transaction_id),
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS reservations_held_expiry_idx ON reservations (expires_at) WHERE status = 'held';`
+
+	// Account lifecycle. New accounts take IDs from a sequence that starts
+	// after any seeded or pre-existing user.
+	addUserLifecycle := `
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+	CHECK (status IN ('active', 'suspended', 'closed'));
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+	CREATE SEQUENCE IF NOT EXISTS users_id_seq OWNED BY users.id;
+	ALTER TABLE users ALTER COLUMN id SET DEFAULT nextval('users_id_seq');
+	SELECT setval('users_id_seq', GREATEST(
+		(SELECT COALESCE(MAX(id), 0) FROM users),
+		(SELECT last_value FROM users_id_seq),
+		1));`
+
+	// Serves the keyset-paginated transaction history, newest first.
+	createTransactionHistoryIndex := `
+	CREATE INDEX IF NOT EXISTS transactions_user_history_idx
+	ON transactions (user_id, created_at DESC, transaction_id DESC);`
+
 	seedUsers := `
-	INSERT INTO users (id, balance) VALUES
-	(1, 0.00), (2, 0.00), (3, 0.00)
+	INSERT INTO users (id) VALUES (1), (2), (3)
 	ON CONFLICT (id) DO NOTHING;`
 
-	statements := []string{createUserTable, createTransactionTable, seedUsers}
+	// ISO-4217 currencies and their minor units. Money holds two decimal
+	// places, so currencies with three (BHD, KWD, ...) are not supported.
+	createCurrencyTable := `
+	CREATE TABLE IF NOT EXISTS currencies (
+		code CHAR(3) PRIMARY KEY,
+		minor_units SMALLINT NOT NULL CHECK (minor_units BETWEEN 0 AND 2)
+	);`
+
+	seedCurrencies := fmt.Sprintf(`
+	INSERT INTO currencies (code, minor_units) VALUES
+	('EUR', 2), ('USD', 2), ('GBP', 2), ('CHF', 2), ('SEK', 2), ('NOK', 2), ('DKK', 2), ('PLN', 2),
+	('CAD', 2), ('AUD', 2), ('NZD', 2), ('BRL', 2), ('MXN', 2), ('ZAR', 2), ('INR', 2), ('SGD', 2),
+	('JPY', 0), ('KRW', 0), ('ISK', 0)
+	ON CONFLICT (code) DO NOTHING;
+	INSERT INTO currencies (code, minor_units) VALUES ('%[1]s', 2)
+	ON CONFLICT (code) DO NOTHING;`, defaultCurrency)
+
+	// One wallet per user and currency. reserved is the part of balance held
+	// by open reservations.
+	createWalletTable := `
+	CREATE TABLE IF NOT EXISTS wallets (
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		currency CHAR(3) NOT NULL REFERENCES currencies(code),
+		balance NUMERIC(12, 2) NOT NULL DEFAULT 0.00,
+		reserved NUMERIC(12, 2) NOT NULL DEFAULT 0.00,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, currency)
+	);`
+
+	// Rows written before wallets existed are in the default currency.
+	addCurrencyColumns := fmt.Sprintf(`
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT '%[1]s'
+	REFERENCES currencies(code);
+	ALTER TABLE rounds ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT '%[1]s'
+	REFERENCES currencies(code);
+	ALTER TABLE reservations ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT '%[1]s'
+	REFERENCES currencies(code);`, defaultCurrency)
+
+	// Cash and bonus sub-balances: bonus is the part of balance that only
+	// converts to cash once wagering_progress reaches wagering_required.
+	addWalletBonus := `
+	ALTER TABLE wallets ADD COLUMN IF NOT EXISTS bonus NUMERIC(12, 2) NOT NULL DEFAULT 0.00 CHECK (bonus >= 0);
+	ALTER TABLE wallets ADD COLUMN IF NOT EXISTS wagering_required NUMERIC(12, 2) NOT NULL DEFAULT 0.00;
+	ALTER TABLE wallets ADD COLUMN IF NOT EXISTS wagering_progress NUMERIC(12, 2) NOT NULL DEFAULT 0.00;`
+
+	// The part of reserved held by withdrawals, which hold cash only. Wallets
+	// with withdrawal holds open when the column is added are backfilled.
+	addWalletReservedCash := `
+	DO $$ BEGIN
+		IF EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'wallets' AND column_name = 'reserved_cash'
+		) THEN
+			RETURN;
+		END IF;
+		ALTER TABLE wallets ADD COLUMN reserved_cash NUMERIC(12, 2) NOT NULL DEFAULT 0.00 CHECK (reserved_cash >= 0);
+		UPDATE wallets w SET reserved_cash = h.amount
+		FROM (
+			SELECT user_id, currency, SUM(amount) AS amount FROM reservations
+			WHERE status = 'held' AND source_type = 'payment'
+			GROUP BY user_id, currency
+		) h
+		WHERE w.user_id = h.user_id AND w.currency = h.currency;
+	END $$;`
+
+	// How each transaction split between cash and bonus (NULL for older rows,
+	// which were all cash), and the terms of bonus grants.
+	addTransactionBonus := `
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS cash_amount NUMERIC(12, 2);
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS bonus_amount NUMERIC(12, 2);
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS bonus_grant BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS wagering_requirement NUMERIC(12, 2);`
+
+	// Responsible-gambling limits per currency. A raise or removal waits in
+	// pending_amount (NULL for a removal) until pending_effective_at.
+	createUserLimitTable := `
+	CREATE TABLE IF NOT EXISTS user_limits (
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		currency CHAR(3) NOT NULL REFERENCES currencies(code),
+		limit_type TEXT NOT NULL CHECK (limit_type IN ('deposit', 'loss', 'wager')),
+		period TEXT NOT NULL CHECK (period IN ('daily', 'weekly', 'monthly')),
+		amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+		pending_amount NUMERIC(12, 2) CHECK (pending_amount > 0),
+		pending_effective_at TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, currency, limit_type, period)
+	);`
+
+	// Self-exclusions and time-outs. Rows are never updated, so they double
+	// as the history; ends_at is NULL for a permanent exclusion.
+	createExclusionTable := `
+	CREATE TABLE IF NOT EXISTS exclusions (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		exclusion_type TEXT NOT NULL CHECK (exclusion_type IN ('self_exclusion', 'time_out')),
+		reason TEXT,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		ends_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS exclusions_user_id_idx ON exclusions (user_id, created_at DESC);
+	ALTER TABLE exclusions ADD COLUMN IF NOT EXISTS actor TEXT NOT NULL DEFAULT 'api';`
+
+	// Transfers between users. Each side is a transaction with the
+	// 'transfer' source type, linked back by transfer_id.
+	createTransferTable := `
+	CREATE TABLE IF NOT EXISTS transfers (
+		transfer_id TEXT PRIMARY KEY,
+		from_user_id BIGINT NOT NULL REFERENCES users(id),
+		to_user_id BIGINT NOT NULL REFERENCES users(id),
+		amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+		currency CHAR(3) NOT NULL REFERENCES currencies(code),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		CHECK (from_user_id <> to_user_id)
+	);
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS transfer_id TEXT REFERENCES transfers(transfer_id);
+	DO $$ BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM pg_constraint
+			WHERE conname = 'transactions_source_type_check' AND pg_get_constraintdef(oid) LIKE '%transfer%'
+		) THEN
+			ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_source_type_check;
+			ALTER TABLE transactions ADD CONSTRAINT transactions_source_type_check
+				CHECK (source_type IN ('game', 'server', 'payment', 'transfer'));
+		END IF;
+	END $$;`
+
+	// Transactions accepted asynchronously. Workers claim the oldest
+	// unfinished item of each user, so the partial index covers the lookup.
+	createTransactionQueueTable := `
+	CREATE TABLE IF NOT EXISTS transaction_queue (
+		id BIGSERIAL PRIMARY KEY,
+		transaction_id TEXT NOT NULL UNIQUE,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		source_type TEXT NOT NULL,
+		request JSONB NOT NULL,
+		request_fingerprint TEXT NOT NULL,
+		callback_url TEXT,
+		status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'processing', 'done', 'failed')),
+		http_status INT,
+		response JSONB,
+		attempts INT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS transaction_queue_pending_idx ON transaction_queue (user_id, id)
+	WHERE status IN ('queued', 'processing');`
+
+	// Wallet balances corrected by reconciliation, kept for audit.
+	createBalanceCorrectionTable := `
+	CREATE TABLE IF NOT EXISTS balance_corrections (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		currency CHAR(3) NOT NULL REFERENCES currencies(code),
+		previous_balance NUMERIC(12, 2) NOT NULL,
+		corrected_balance NUMERIC(12, 2) NOT NULL,
+		ledger_balance NUMERIC(12, 2) NOT NULL,
+		actor TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Every balance change with the balance before and after. Append-only:
+	// the trigger rejects updates and deletes.
+	createBalanceAuditTable := `
+	CREATE TABLE IF NOT EXISTS balance_audit (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		currency CHAR(3) NOT NULL REFERENCES currencies(code),
+		previous_balance NUMERIC(12, 2) NOT NULL,
+		new_balance NUMERIC(12, 2) NOT NULL,
+		actor TEXT NOT NULL,
+		source_type TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		transaction_id TEXT REFERENCES transactions(transaction_id),
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS balance_audit_user_id_idx ON balance_audit (user_id, id DESC);
+
+	CREATE OR REPLACE FUNCTION reject_balance_audit_change() RETURNS TRIGGER AS $$
+	BEGIN
+		RAISE EXCEPTION 'balance_audit is append-only';
+	END $$ LANGUAGE plpgsql;
+
+	DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'balance_audit_append_only') THEN
+			CREATE TRIGGER balance_audit_append_only BEFORE UPDATE OR DELETE ON balance_audit
+			FOR EACH ROW EXECUTE FUNCTION reject_balance_audit_change();
+		END IF;
+	END $$;`
+
+	// Domain events written with the change they describe and published by
+	// the outbox relay; published_at is set once a sink has accepted one.
+	createOutboxTable := `
+	CREATE TABLE IF NOT EXISTS outbox_events (
+		id BIGSERIAL PRIMARY KEY,
+		event_type TEXT NOT NULL,
+		user_id BIGINT NOT NULL REFERENCES users(id),
+		payload JSONB NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		published_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS outbox_events_unpublished_idx ON outbox_events (id) WHERE published_at IS NULL;`
+
+	// Webhook subscriptions, fed from the outbox. Each matching event becomes
+	// a delivery, retried with backoff; exhausted ones are copied to the
+	// dead-letter table, which outlives the subscription.
+	createWebhookTables := `
+	CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		id BIGSERIAL PRIMARY KEY,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT[] NOT NULL,
+		user_id BIGINT REFERENCES users(id),
+		threshold NUMERIC(12, 2),
+		currency CHAR(3) REFERENCES currencies(code),
+		active BOOLEAN NOT NULL DEFAULT TRUE,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		webhook_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+		event_id BIGINT NOT NULL REFERENCES outbox_events(id),
+		event_type TEXT NOT NULL,
+		body TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+		attempts INT NOT NULL DEFAULT 0,
+		last_status_code INT,
+		last_error TEXT,
+		next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		delivered_at TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (webhook_id, event_id, event_type)
+	);
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+	CREATE INDEX IF NOT EXISTS webhook_deliveries_log_idx ON webhook_deliveries (webhook_id, id DESC);
+
+	CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+		id BIGSERIAL PRIMARY KEY,
+		delivery_id BIGINT NOT NULL UNIQUE,
+		webhook_id BIGINT NOT NULL,
+		url TEXT NOT NULL,
+		event_id BIGINT NOT NULL,
+		event_type TEXT NOT NULL,
+		body TEXT NOT NULL,
+		attempts INT NOT NULL,
+		last_status_code INT,
+		last_error TEXT,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	// Balance streams replay a user's events after the Last-Event-ID they
+	// resume from.
+	createOutboxUserIndex := `
+	CREATE INDEX IF NOT EXISTS outbox_events_user_idx ON outbox_events (user_id, id);`
+
+	// Double-entry ledger. Wallet balances are a projection of the postings
+	// against each user's wallet account.
+	createLedgerAccountTable := `
+	CREATE TABLE IF NOT EXISTS ledger_accounts (
+		id BIGSERIAL PRIMARY KEY,
+		code TEXT NOT NULL UNIQUE,
+		kind TEXT NOT NULL CHECK (kind IN ('user_wallet', 'house')),
+		user_id BIGINT REFERENCES users(id),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createJournalEntryTable := `
+	CREATE TABLE IF NOT EXISTS journal_entries (
+		id BIGSERIAL PRIMARY KEY,
+		transaction_id TEXT REFERENCES transactions(transaction_id),
+		description TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	createPostingTable := `
+	CREATE TABLE IF NOT EXISTS postings (
+		id BIGSERIAL PRIMARY KEY,
+		entry_id BIGINT NOT NULL REFERENCES journal_entries(id),
+		account_id BIGINT NOT NULL REFERENCES ledger_accounts(id),
+		direction TEXT NOT NULL CHECK (direction IN ('debit', 'credit')),
+		amount NUMERIC(12, 2) NOT NULL CHECK (amount > 0)
+	);
+	CREATE INDEX IF NOT EXISTS postings_account_id_idx ON postings (account_id);
+	CREATE INDEX IF NOT EXISTS postings_entry_id_idx ON postings (entry_id);`
+
+	// Ledger accounts hold a single currency. Accounts opened before
+	// currencies existed are in the default one and get its code as suffix.
+	addLedgerAccountCurrency := fmt.Sprintf(`
+	ALTER TABLE ledger_accounts ADD COLUMN IF NOT EXISTS currency CHAR(3) REFERENCES currencies(code);
+	UPDATE ledger_accounts SET currency = '%[1]s', code = code || ':%[1]s' WHERE currency IS NULL;`, defaultCurrency)
+
+	// Reject any journal entry whose debits and credits differ, per currency,
+	// at commit time.
+	createBalancedEntryTrigger := `
+	CREATE OR REPLACE FUNCTION assert_journal_entry_balanced() RETURNS TRIGGER AS $$
+	BEGIN
+		IF EXISTS (
+			SELECT 1 FROM postings p
+			JOIN ledger_accounts a ON a.id = p.account_id
+			WHERE p.entry_id = NEW.entry_id
+			GROUP BY a.currency
+			HAVING SUM(CASE p.direction WHEN 'debit' THEN p.amount ELSE -p.amount END) <> 0
+		) THEN
+			RAISE EXCEPTION 'journal entry % is not balanced', NEW.entry_id;
+		END IF;
+		RETURN NULL;
+	END $$ LANGUAGE plpgsql;
+
+	DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'postings_balanced') THEN
+			CREATE CONSTRAINT TRIGGER postings_balanced AFTER INSERT ON postings
+			DEFERRABLE INITIALLY DEFERRED
+			FOR EACH ROW EXECUTE FUNCTION assert_journal_entry_balanced();
+		END IF;
+	END $$;`
+
+	// House accounts in other currencies are opened on first use.
+	seedHouseAccounts := fmt.Sprintf(`
+	INSERT INTO ledger_accounts (code, kind, currency) VALUES
+	('house:game_revenue:%[1]s', 'house', '%[1]s'),
+	('house:payment_clearing:%[1]s', 'house', '%[1]s'),
+	('house:server_adjustments:%[1]s', 'house', '%[1]s'),
+	('house:opening_balance:%[1]s', 'house', '%[1]s'),
+	('house:promotions:%[1]s', 'house', '%[1]s'),
+	('house:transfers:%[1]s', 'house', '%[1]s'),
+	('house:reconciliation:%[1]s', 'house', '%[1]s')
+	ON CONFLICT (code) DO NOTHING;`, defaultCurrency)
+
+	// Balances that predate the ledger get a single opening entry so that
+	// they can always be rebuilt from postings. Only databases that still
+	// keep the balance on users can have any.
+	backfillOpeningBalances := fmt.Sprintf(`
+	DO $$
+	DECLARE
+		u RECORD;
+		entry BIGINT;
+		wallet BIGINT;
+		opening BIGINT;
+	BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'balance'
+		) THEN
+			RETURN;
+		END IF;
+		SELECT id INTO opening FROM ledger_accounts WHERE code = 'house:opening_balance:%[1]s';
+		FOR u IN
+			SELECT id, balance FROM users
+			WHERE balance <> 0
+			AND NOT EXISTS (SELECT 1 FROM ledger_accounts a WHERE a.kind = 'user_wallet' AND a.user_id = users.id)
+		LOOP
+			INSERT INTO ledger_accounts (code, kind, user_id, currency)
+			VALUES ('user:' || u.id || ':wallet:%[1]s', 'user_wallet', u.id, '%[1]s') RETURNING id INTO wallet;
+			INSERT INTO journal_entries (description) VALUES ('opening balance') RETURNING id INTO entry;
+			INSERT INTO postings (entry_id, account_id, direction, amount) VALUES
+			(entry, opening, CASE WHEN u.balance > 0 THEN 'debit' ELSE 'credit' END, ABS(u.balance)),
+			(entry, wallet, CASE WHEN u.balance > 0 THEN 'credit' ELSE 'debit' END, ABS(u.balance));
+		END LOOP;
+	END $$;`, defaultCurrency)
+
+	// Move balances still kept on users into default-currency wallets.
+	migrateUserBalances := fmt.Sprintf(`
+	DO $$ BEGIN
+		IF NOT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'balance'
+		) THEN
+			RETURN;
+		END IF;
+		IF EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'reserved'
+		) THEN
+			INSERT INTO wallets (user_id, currency, balance, reserved)
+			SELECT id, '%[1]s', balance, reserved FROM users
+			ON CONFLICT (user_id, currency) DO NOTHING;
+		ELSE
+			INSERT INTO wallets (user_id, currency, balance)
+			SELECT id, '%[1]s', balance FROM users
+			ON CONFLICT (user_id, currency) DO NOTHING;
+		END IF;
+		ALTER TABLE users DROP COLUMN balance;
+		ALTER TABLE users DROP COLUMN IF EXISTS reserved;
+	END $$;`, defaultCurrency)
+
+	seedWallets := fmt.Sprintf(`
+	INSERT INTO wallets (user_id, currency) VALUES (1, '%[1]s'), (2, '%[1]s'), (3, '%[1]s')
+	ON CONFLICT (user_id, currency) DO NOTHING;`, defaultCurrency)
+
+	statements := []string{
+		createUserTable, createTransactionTable, addTransactionBalanceAfter, addTransactionFingerprint,
+		addTransactionReversal, createRoundTable, addTransactionRound, keyRoundsByUser, createTransactionHistoryIndex,
+		seedUsers, createReservationTable, addUserLifecycle,
+		createCurrencyTable, seedCurrencies, createWalletTable, addCurrencyColumns,
+		createLedgerAccountTable, createJournalEntryTable, createPostingTable, addLedgerAccountCurrency,
+		createBalancedEntryTrigger, seedHouseAccounts, backfillOpeningBalances,
+		migrateUserBalances, seedWallets, addWalletBonus, addWalletReservedCash, addTransactionBonus,
+		createUserLimitTable, createExclusionTable, createTransferTable, createTransactionQueueTable,
+		createBalanceCorrectionTable, createBalanceAuditTable, createOutboxTable, createWebhookTables,
+		createOutboxUserIndex,
+	}
 
 	for _, stmt := range statements {
 		if _, err := DB.Exec(stmt); err != nil {
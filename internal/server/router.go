@@ -0,0 +1,81 @@
+// Package server wires the HTTP API: the routes and the handlers behind them.
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"entain-app/api"
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+// NewRouter returns the router serving every HTTP route. Each route must be
+// described in api/openapi.json, which the tests check.
+func NewRouter() *mux.Router {
+	r := mux.NewRouter()
+
+	// Main API routes
+	r.HandleFunc("/users", user.HandleCreateUser).Methods("POST")
+	r.HandleFunc("/user/{userId}", user.HandleGetUser).Methods("GET")
+	r.HandleFunc("/user/{userId}/status", user.HandleUpdateUserStatus).Methods("PUT")
+	r.HandleFunc("/user/{userId}/transaction", user.HandleTransaction).Methods("POST")
+	r.HandleFunc("/user/{userId}/transaction/{transactionId}", user.HandleGetTransaction).Methods("GET")
+	r.HandleFunc("/user/{userId}/transaction/{transactionId}/reverse", user.HandleReverseTransaction).Methods("POST")
+	r.HandleFunc("/user/{userId}/transaction/{transactionId}/status", user.HandleQueuedTransactionStatus).Methods("GET")
+	r.HandleFunc("/user/{userId}/balance", user.HandleBalance).Methods("GET")
+	r.HandleFunc("/user/{userId}/balance/audit", user.HandleBalanceAudit).Methods("GET")
+	r.HandleFunc("/user/{userId}/balance/stream", user.HandleBalanceStream).Methods("GET")
+	r.HandleFunc("/user/{userId}/wallets", user.HandleOpenWallet).Methods("POST")
+	r.HandleFunc("/user/{userId}/bonus", user.HandleGrantBonus).Methods("POST")
+	r.HandleFunc("/user/{userId}/transactions", user.HandleTransactionHistory).Methods("GET")
+	r.HandleFunc("/user/{userId}/limits", user.HandleListLimits).Methods("GET")
+	r.HandleFunc("/user/{userId}/limits", user.HandleSetLimit).Methods("PUT")
+	r.HandleFunc("/user/{userId}/limits/{limitType}/{period}", user.HandleRemoveLimit).Methods("DELETE")
+	r.HandleFunc("/user/{userId}/exclusions", user.HandleListExclusions).Methods("GET")
+	r.HandleFunc("/user/{userId}/exclusions", user.HandleCreateExclusion).Methods("POST")
+	r.HandleFunc("/transactions:batch", user.HandleBatch).Methods("POST")
+	r.HandleFunc("/transactions:stream", user.HandleTransactionStream).Methods("POST")
+	r.HandleFunc("/transfers", user.HandleCreateTransfer).Methods("POST")
+	r.HandleFunc("/transfers/{transferId}", user.HandleGetTransfer).Methods("GET")
+	r.HandleFunc("/webhooks", user.HandleListWebhooks).Methods("GET")
+	r.HandleFunc("/webhooks", user.HandleCreateWebhook).Methods("POST")
+	r.HandleFunc("/webhooks/{webhookId}", user.HandleGetWebhook).Methods("GET")
+	r.HandleFunc("/webhooks/{webhookId}", user.HandleUpdateWebhook).Methods("PUT")
+	r.HandleFunc("/webhooks/{webhookId}", user.HandleDeleteWebhook).Methods("DELETE")
+	r.HandleFunc("/webhooks/{webhookId}/deliveries", user.HandleWebhookDeliveries).Methods("GET")
+	r.HandleFunc("/user/{userId}/rounds/{roundId}", user.HandleGetRound).Methods("GET")
+	r.HandleFunc("/user/{userId}/reservations", user.HandleAuthorizeReservation).Methods("POST")
+	r.HandleFunc("/user/{userId}/reservations/{reservationId}", user.HandleGetReservation).Methods("GET")
+	r.HandleFunc("/user/{userId}/reservations/{reservationId}/capture", user.HandleCaptureReservation).Methods("POST")
+	r.HandleFunc("/user/{userId}/reservations/{reservationId}/release", user.HandleReleaseReservation).Methods("POST")
+
+	// Health check route
+	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if err := db.DB.Ping(); err != nil {
+			http.Error(w, `{"status":"unhealthy","database":"disconnected"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok","database":"connected"}`))
+	}).Methods("GET")
+
+	// Prometheus metrics endpoint
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	// Root route for browser base URL access
+	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Entain API is running. See /health or /user/{id}/balance"))
+	}).Methods("GET")
+
+	// OpenAPI document describing the routes above
+	r.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(api.OpenAPI)
+	}).Methods("GET")
+
+	return r
+}
@@ -0,0 +1,164 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+var (
+	ErrAccountNotActive = errors.New("account is not active")
+	ErrAccountClosed    = errors.New("account is closed")
+	ErrAccountHasFunds  = errors.New("account still holds funds")
+	ErrInvalidStatus    = errors.New("invalid account status")
+)
+
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusClosed    = "closed"
+)
+
+// Account is a player account with its lifecycle status and wallets.
+type Account struct {
+	UserID    uint64           `json:"userId"`
+	Status    string           `json:"status"`
+	Wallets   []WalletResponse `json:"wallets"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+// IsValidStatus reports whether s is a known account status.
+func IsValidStatus(s string) bool {
+	return s == StatusActive || s == StatusSuspended || s == StatusClosed
+}
+
+// CreateAccount opens a new active account with an empty wallet in the
+// default currency.
+func CreateAccount() (*Account, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	a, err := scanAccount(tx.QueryRow(`
+		INSERT INTO users DEFAULT VALUES
+		RETURNING ` + accountColumns))
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO wallets (user_id, currency) VALUES ($1, $2)`, a.UserID, DefaultCurrency())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wallet: %w", err)
+	}
+	w, err := lockWallet(tx, a.UserID, DefaultCurrency())
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	a.Wallets = []WalletResponse{w.Response()}
+
+	utils.Logger.WithField("user_id", a.UserID).Info("Created account")
+	return a, nil
+}
+
+// GetAccount returns the account details for a user.
+func GetAccount(userID uint64) (*Account, error) {
+	a, err := scanAccount(db.DB.QueryRow(`SELECT `+accountColumns+` FROM users WHERE id = $1`, userID))
+	if err != nil {
+		return nil, err
+	}
+	if err := a.loadWallets(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// UpdateAccountStatus moves an account between active and suspended, or
+// closes it. Closing is final and requires every wallet to hold no funds.
+func UpdateAccountStatus(userID uint64, status string) (*Account, error) {
+	if !IsValidStatus(status) {
+		return nil, ErrInvalidStatus
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	a, err := scanAccount(tx.QueryRow(`SELECT `+accountColumns+` FROM users WHERE id = $1 FOR UPDATE`, userID))
+	if err != nil {
+		return nil, err
+	}
+	if a.Status == status {
+		return a, nil
+	}
+	if a.Status == StatusClosed {
+		return nil, ErrAccountClosed
+	}
+	if status == StatusClosed {
+		var funded bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM wallets WHERE user_id = $1 AND (balance <> 0 OR reserved <> 0))`,
+			userID).Scan(&funded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check wallets: %w", err)
+		}
+		if funded {
+			return nil, ErrAccountHasFunds
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET status = $1 WHERE id = $2`, status, userID); err != nil {
+		return nil, fmt.Errorf("failed to update account status: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id": userID,
+		"from":    a.Status,
+		"to":      status,
+	}).Info("Updated account status")
+
+	a.Status = status
+	if err := a.loadWallets(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// loadWallets fills in the account's wallets.
+func (a *Account) loadWallets() error {
+	wallets, err := ListWallets(a.UserID, "")
+	if err != nil {
+		return err
+	}
+	a.Wallets = make([]WalletResponse, 0, len(wallets))
+	for _, w := range wallets {
+		a.Wallets = append(a.Wallets, w.Response())
+	}
+	return nil
+}
+
+const accountColumns = `id, status, created_at`
+
+func scanAccount(row rowScanner) (*Account, error) {
+	var a Account
+	err := row.Scan(&a.UserID, &a.Status, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch account: %w", err)
+	}
+	a.CreatedAt = a.CreatedAt.UTC()
+	return &a, nil
+}
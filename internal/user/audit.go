@@ -0,0 +1,173 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"entain-app/internal/db"
+)
+
+// Actors recorded in the balance audit trail: the part of the service that
+// changed the balance. Source types name the calling system separately.
+const (
+	ActorAPI           = "api"
+	ActorAsyncWorker   = "async-worker"
+	ActorLedgerRebuild = "ledger-rebuild"
+)
+
+// BalanceAuditEntry records one change to a wallet balance. The audit table
+// is append-only; a trigger rejects updates and deletes.
+type BalanceAuditEntry struct {
+	ID              int64     `json:"id"`
+	UserID          uint64    `json:"userId"`
+	Currency        string    `json:"currency"`
+	PreviousBalance Money     `json:"previousBalance"`
+	NewBalance      Money     `json:"newBalance"`
+	Change          Money     `json:"change"`
+	Actor           string    `json:"actor"`
+	SourceType      string    `json:"sourceType"`
+	Reason          string    `json:"reason"`
+	TransactionID   string    `json:"transactionId,omitempty"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// balanceChange is a balance mutation about to be written to the audit trail
+// and published as an Event of type Event.
+type balanceChange struct {
+	Event         string
+	UserID        uint64
+	Currency      string
+	Previous      Money
+	New           Money
+	Actor         string
+	SourceType    string
+	Reason        string
+	TransactionID string
+}
+
+// recordBalanceChange appends a change to the audit trail and the outbox
+// inside tx, so both commit or roll back with the balance they describe.
+// Every path that writes wallets.balance calls it.
+func recordBalanceChange(tx *sql.Tx, c balanceChange) error {
+	if c.Actor == "" {
+		c.Actor = ActorAPI
+	}
+	_, err := tx.Exec(`
+		INSERT INTO balance_audit (user_id, currency, previous_balance, new_balance, actor, source_type, reason, transaction_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		c.UserID, c.Currency, c.Previous, c.New, c.Actor, c.SourceType, c.Reason, nullString(c.TransactionID))
+	if err != nil {
+		return fmt.Errorf("failed to record balance audit: %w", err)
+	}
+	return enqueueEvent(tx, c.Event, c.UserID, BalanceEvent{
+		TransactionID:   c.TransactionID,
+		Currency:        c.Currency,
+		PreviousBalance: c.Previous,
+		Balance:         c.New,
+		Change:          c.New - c.Previous,
+		Actor:           c.Actor,
+		SourceType:      c.SourceType,
+		Reason:          c.Reason,
+	})
+}
+
+// transactionReason describes why a transaction changed the balance.
+func transactionReason(in transactionInput) string {
+	switch {
+	case in.Bonus:
+		return "bonus_grant"
+	case in.Capture:
+		return "capture"
+	default:
+		return in.State
+	}
+}
+
+// ListBalanceAudit returns a page of the user's balance audit trail, newest
+// first.
+func ListBalanceAudit(userID uint64, f AuditFilter) ([]BalanceAuditEntry, string, error) {
+	if err := ensureUserExists(userID); err != nil {
+		return nil, "", err
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultHistoryLimit
+	}
+	if f.Limit > MaxHistoryLimit {
+		f.Limit = MaxHistoryLimit
+	}
+
+	conds := []string{"user_id = $1"}
+	args := []interface{}{userID}
+	if f.Currency != "" {
+		args = append(args, strings.ToUpper(f.Currency))
+		conds = append(conds, fmt.Sprintf("currency = $%d", len(args)))
+	}
+	if f.Cursor != "" {
+		before, err := decodeIDCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, before)
+		conds = append(conds, fmt.Sprintf("id < $%d", len(args)))
+	}
+
+	args = append(args, f.Limit+1)
+	rows, err := db.DB.Query(fmt.Sprintf(`
+		SELECT %s FROM balance_audit
+		WHERE %s
+		ORDER BY id DESC
+		LIMIT $%d`, auditColumns, strings.Join(conds, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list balance audit: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]BalanceAuditEntry, 0, f.Limit+1)
+	for rows.Next() {
+		var e BalanceAuditEntry
+		err := rows.Scan(&e.ID, &e.UserID, &e.Currency, &e.PreviousBalance, &e.NewBalance, &e.Actor, &e.SourceType,
+			&e.Reason, &e.TransactionID, &e.CreatedAt)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to scan balance audit: %w", err)
+		}
+		e.Change = e.NewBalance - e.PreviousBalance
+		e.CreatedAt = e.CreatedAt.UTC()
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to list balance audit: %w", err)
+	}
+
+	var next string
+	if len(entries) > f.Limit {
+		entries = entries[:f.Limit]
+		next = encodeIDCursor(entries[len(entries)-1].ID)
+	}
+	return entries, next, nil
+}
+
+const auditColumns = `id, user_id, currency, previous_balance, new_balance, actor, source_type, reason,
+		COALESCE(transaction_id, ''), created_at`
+
+// Audit entries and webhook deliveries are paged on their sequential ID, so
+// the cursor is the last ID seen.
+func encodeIDCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeIDCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
@@ -0,0 +1,159 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"entain-app/configs"
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+// balanceEventsChannel is the Postgres NOTIFY channel carrying the ID of
+// each user whose balance changed, sent when the change commits.
+const balanceEventsChannel = "balance_events"
+
+// balanceStreamBatch bounds the events read per query while a stream
+// catches up.
+const balanceStreamBatch = 100
+
+var balanceStreamCfg = configs.LoadBalanceStreamConfig()
+
+// balanceBroker wakes the balance streams open in this process when a
+// notification names their user. Streams read the events themselves, so a
+// dropped wake-up only delays them until the next heartbeat.
+type balanceBroker struct {
+	mu      sync.Mutex
+	subs    map[uint64]map[chan struct{}]bool
+	stopped chan struct{}
+}
+
+var balanceStreams = &balanceBroker{
+	subs:    make(map[uint64]map[chan struct{}]bool),
+	stopped: make(chan struct{}),
+}
+
+// subscribe returns a channel signalled when userID's balance changes and a
+// function that unsubscribes it.
+func (b *balanceBroker) subscribe(userID uint64) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+	b.mu.Lock()
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[chan struct{}]bool)
+	}
+	b.subs[userID][wake] = true
+	b.mu.Unlock()
+
+	return wake, func() {
+		b.mu.Lock()
+		delete(b.subs[userID], wake)
+		if len(b.subs[userID]) == 0 {
+			delete(b.subs, userID)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// wake signals the streams of userID, or of every user if all is set.
+func (b *balanceBroker) wake(userID uint64, all bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, subs := range b.subs {
+		if !all && id != userID {
+			continue
+		}
+		for c := range subs {
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// StartBalanceListener listens for balance notifications from every server
+// instance and wakes the matching streams until ctx is cancelled, which
+// also ends the open streams.
+func StartBalanceListener(ctx context.Context) error {
+	listener := pq.NewListener(configs.LoadDBConfig().DSN(), time.Second, time.Minute,
+		func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				utils.Logger.WithError(err).Warn("Balance listener connection problem")
+			}
+		})
+	if err := listener.Listen(balanceEventsChannel); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to listen for balance events: %w", err)
+	}
+
+	go func() {
+		defer listener.Close()
+		defer close(balanceStreams.stopped)
+		ping := time.NewTicker(time.Minute)
+		defer ping.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-listener.Notify:
+				if n == nil {
+					// Reconnected; notifications may have been missed
+					balanceStreams.wake(0, true)
+					continue
+				}
+				userID, err := strconv.ParseUint(n.Extra, 10, 64)
+				if err != nil {
+					utils.Logger.WithField("payload", n.Extra).Warn("Malformed balance notification")
+					continue
+				}
+				balanceStreams.wake(userID, false)
+			case <-ping.C:
+				go listener.Ping()
+			}
+		}
+	}()
+	return nil
+}
+
+// latestEventID returns the ID of the user's latest event, or 0.
+func latestEventID(userID uint64) (int64, error) {
+	var id int64
+	err := db.DB.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM outbox_events WHERE user_id = $1`, userID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch latest event: %w", err)
+	}
+	return id, nil
+}
+
+// eventsAfter returns up to limit of the user's events with IDs above
+// afterID, in ID order. A user's changes are made under their lock, so IDs
+// follow commit order and none can later appear below the last one read.
+func eventsAfter(userID uint64, afterID int64, limit int) ([]Event, error) {
+	rows, err := db.DB.Query(`
+		SELECT `+eventColumns+` FROM outbox_events
+		WHERE user_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3`, userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch events: %w", err)
+	}
+	return events, nil
+}
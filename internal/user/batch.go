@@ -0,0 +1,139 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+// ErrBatchRolledBack is the outcome of every other item when an item of an
+// atomic batch fails.
+var ErrBatchRolledBack = errors.New("not applied: another item in the atomic batch failed")
+
+const (
+	BatchAtomic     = "atomic"      // all items apply or none do
+	BatchBestEffort = "best_effort" // each item applies on its own
+
+	MaxBatchSize = 1000
+)
+
+// BatchOutcome is the result of one batch item: the same result or error
+// ProcessTransaction would have returned for it.
+type BatchOutcome struct {
+	Result *TransactionResult
+	Err    error
+}
+
+// ProcessBatch applies items in order. In best-effort mode each item runs in
+// its own DB transaction, exactly as ProcessTransaction. In atomic mode they
+// share one, and the first failing item rolls back the whole batch; its
+// outcome carries the error and every other item gets ErrBatchRolledBack.
+// Either way a transaction ID that was already applied replays or conflicts
+// as it would on its own.
+func ProcessBatch(items []BatchItem, atomic bool) []BatchOutcome {
+	outcomes := make([]BatchOutcome, len(items))
+	inputs := make([]transactionInput, len(items))
+	failed := false
+	for i, item := range items {
+		in, err := newTransactionInput(item.UserID, item.TransactionRequest, item.SourceType)
+		if err != nil {
+			outcomes[i].Err = err
+			failed = true
+		}
+		inputs[i] = in
+	}
+
+	if !atomic {
+		for i, in := range inputs {
+			if outcomes[i].Err == nil {
+				outcomes[i].Result, outcomes[i].Err = processTransaction(in)
+			}
+		}
+		return outcomes
+	}
+
+	if !failed {
+		if err := applyBatchAtomic(inputs, outcomes); err != nil {
+			for i := range outcomes {
+				outcomes[i] = BatchOutcome{Err: err}
+			}
+			return outcomes
+		}
+	}
+	for i := range outcomes {
+		if outcomes[i].Err != nil {
+			failed = true
+		}
+	}
+	if failed {
+		for i := range outcomes {
+			if outcomes[i].Err == nil {
+				outcomes[i] = BatchOutcome{Err: ErrBatchRolledBack}
+			}
+		}
+	}
+	return outcomes
+}
+
+// applyBatchAtomic applies inputs in one DB transaction, filling outcomes. It
+// stops at the first failing item and leaves the transaction uncommitted;
+// the returned error is for failures that are not any one item's.
+func applyBatchAtomic(inputs []transactionInput, outcomes []BatchOutcome) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock every user up front in ascending ID order, so that batches over
+	// the same users cannot deadlock. Unknown users fail on their item.
+	seen := make(map[uint64]bool)
+	var userIDs []uint64
+	for _, in := range inputs {
+		if !seen[in.UserID] {
+			seen[in.UserID] = true
+			userIDs = append(userIDs, in.UserID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	for _, id := range userIDs {
+		if _, err := lockUser(tx, id); err != nil && err != ErrUserNotFound {
+			return err
+		}
+	}
+
+	for i, in := range inputs {
+		// A duplicate is turned away by the claim before it changes anything
+		result, err := applyTransactionTx(tx, in)
+		if errors.Is(err, ErrDuplicateTransaction) {
+			orig, ferr := findStoredTransaction(in.TransactionID)
+			if ferr != nil {
+				return ferr
+			}
+			if orig == nil {
+				// Claimed earlier in this batch
+				result, err = nil, ErrDuplicateTransaction
+			} else {
+				result, err = replayOrConflict(orig, in)
+			}
+		}
+		outcomes[i] = BatchOutcome{Result: result, Err: err}
+		if err != nil {
+			return nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return mapUniqueViolation(err, "failed to commit transaction")
+	}
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"items": len(inputs),
+		"users": len(userIDs),
+	}).Info("Processed atomic batch")
+
+	return nil
+}
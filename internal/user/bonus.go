@@ -0,0 +1,219 @@
+package user
+
+import (
+	"errors"
+	"strings"
+
+	"entain-app/configs"
+	"entain-app/pkg/utils"
+)
+
+var (
+	ErrInsufficientCash = errors.New("insufficient withdrawable balance")
+	ErrInvalidWagering  = errors.New("invalid wagering requirement")
+)
+
+var bonusCfg = configs.LoadBonusConfig()
+
+// Split is how a transaction amount landed on the cash and bonus
+// sub-balances of a wallet.
+type Split struct {
+	Cash  Money
+	Bonus Money
+}
+
+// Cash is the withdrawable part of the wallet balance.
+func (w *Wallet) Cash() Money {
+	return w.Balance - w.Bonus
+}
+
+// AvailableCash is the cash not already held by withdrawal reservations.
+func (w *Wallet) AvailableCash() Money {
+	return w.Cash() - w.ReservedCash
+}
+
+// WageringRemaining is what must still be staked before the bonus converts.
+func (w *Wallet) WageringRemaining() Money {
+	if w.WageringProgress >= w.WageringRequired {
+		return 0
+	}
+	return w.WageringRequired - w.WageringProgress
+}
+
+// bonusActive reports whether the wallet holds bonus funds still being wagered.
+func (w *Wallet) bonusActive() bool {
+	return w.Bonus > 0 && w.WageringRemaining() > 0
+}
+
+// apply moves the wallet by one transaction and returns the split. A lose
+// may only spend the available balance; withdrawals (payment loses) and
+// outgoing transfers may only spend cash not held by other withdrawals, and
+// other loses follow the
+// configured consumption order. Game
+// stakes count towards wagering, and game wins while a bonus is being wagered
+// are bonus funds.
+func (w *Wallet) apply(in transactionInput) (Split, error) {
+	var sp Split
+	switch in.State {
+	case "win":
+		if in.Bonus || (in.SourceType == "game" && w.bonusActive()) {
+			sp.Bonus = in.Amount
+		} else {
+			sp.Cash = in.Amount
+		}
+		if err := w.credit(sp); err != nil {
+			return Split{}, err
+		}
+		if in.Bonus {
+			required, err := w.WageringRequired.Add(in.Wagering)
+			if err != nil {
+				return Split{}, err
+			}
+			w.WageringRequired = required
+		}
+	case "lose":
+		if w.Available() < in.Amount {
+			return Split{}, ErrInsufficientBalance
+		}
+		switch {
+		case in.SourceType == "payment" || in.SourceType == "transfer":
+			if w.AvailableCash() < in.Amount {
+				return Split{}, ErrInsufficientCash
+			}
+			sp.Cash = in.Amount
+		case bonusCfg.ConsumptionOrder == configs.BonusFirst:
+			sp.Bonus = minMoney(w.Bonus, in.Amount)
+			sp.Cash = in.Amount - sp.Bonus
+		default:
+			sp.Cash = minMoney(w.AvailableCash(), in.Amount)
+			sp.Bonus = in.Amount - sp.Cash
+		}
+		w.debit(sp)
+		if in.SourceType == "game" && w.bonusActive() {
+			w.WageringProgress = minMoney(w.WageringProgress+in.Amount, w.WageringRequired)
+		}
+	default:
+		return Split{}, errors.New("invalid state value")
+	}
+	w.settleBonus()
+	return sp, nil
+}
+
+// reverse undoes a stored split. Funds go back to the sub-balance they came
+// from; when that sub-balance no longer holds them (a converted or spent
+// bonus), the shortfall comes from the other one. Wagering progress is not
+// rewound.
+func (w *Wallet) reverse(orig Split, origState string) (Split, error) {
+	if origState == "lose" {
+		if err := w.credit(orig); err != nil {
+			return Split{}, err
+		}
+		w.settleBonus()
+		return orig, nil
+	}
+
+	amount := orig.Cash + orig.Bonus
+	if w.Available() < amount {
+		return Split{}, ErrInsufficientBalance
+	}
+	sp := Split{Bonus: minMoney(orig.Bonus, w.Bonus)}
+	sp.Cash = amount - sp.Bonus
+	if sp.Cash > w.AvailableCash() {
+		sp.Cash = w.AvailableCash()
+		sp.Bonus = amount - sp.Cash
+	}
+	w.debit(sp)
+	w.settleBonus()
+	return sp, nil
+}
+
+func (w *Wallet) credit(sp Split) error {
+	balance, err := w.Balance.Add(sp.Cash + sp.Bonus)
+	if err != nil {
+		return err
+	}
+	w.Balance = balance
+	w.Bonus += sp.Bonus
+	return nil
+}
+
+func (w *Wallet) debit(sp Split) {
+	w.Balance -= sp.Cash + sp.Bonus
+	w.Bonus -= sp.Bonus
+}
+
+// settleBonus converts the bonus to cash once wagering is complete, and
+// clears the requirement once no bonus funds are left.
+func (w *Wallet) settleBonus() {
+	if w.Bonus > 0 && w.WageringRemaining() > 0 {
+		return
+	}
+	if w.Bonus > 0 {
+		utils.Logger.WithFields(map[string]interface{}{
+			"user_id":  w.UserID,
+			"currency": w.Currency,
+			"amount":   w.Bonus.String(),
+		}).Info("Converted bonus to cash")
+	}
+	w.Bonus = 0
+	w.WageringRequired = 0
+	w.WageringProgress = 0
+}
+
+func minMoney(a, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// GrantBonus credits a promotion to the bonus sub-balance of the user's
+// wallet. The funds convert to cash once WageringRequirement has been staked
+// in game loses. Grants are idempotent by transaction ID like any other
+// transaction.
+func GrantBonus(userID uint64, req BonusRequest) (*TransactionResult, error) {
+	if isReservedTransactionID(req.TransactionID) {
+		return nil, ErrReservedTransactionID
+	}
+
+	amount, err := ParseMoney(req.Amount)
+	if err == ErrAmountOverflow {
+		return nil, ErrAmountOverflow
+	}
+	if err != nil || amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	var wagering Money
+	if strings.TrimSpace(req.WageringRequirement) != "" {
+		wagering, err = ParseMoney(req.WageringRequirement)
+		if err != nil || wagering < 0 {
+			return nil, ErrInvalidWagering
+		}
+	}
+
+	currency := normalizeCurrency(req.Currency)
+	if err := checkCurrencyAmount(currency, amount); err != nil {
+		return nil, err
+	}
+
+	return processTransaction(transactionInput{
+		UserID:        userID,
+		TransactionID: req.TransactionID,
+		Amount:        amount,
+		State:         "win",
+		SourceType:    "server",
+		Currency:      currency,
+		Bonus:         true,
+		Wagering:      wagering,
+	})
+}
+
+// splitOf reads the stored split of a transaction; rows written before the
+// split was tracked were all cash.
+func splitOf(amount Money, cash, bonus *Money) Split {
+	if cash == nil || bonus == nil {
+		return Split{Cash: amount}
+	}
+	return Split{Cash: *cash, Bonus: *bonus}
+}
@@ -0,0 +1,185 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+var (
+	ErrExcluded         = errors.New("account is excluded from gaming")
+	ErrInvalidExclusion = errors.New("invalid exclusion")
+)
+
+const (
+	ExclusionSelf    = "self_exclusion" // set by the player, fixed or permanent
+	ExclusionTimeOut = "time_out"       // applied by support staff, always fixed
+)
+
+// Exclusion blocks a user from staking on games until EndsAt. Exclusions are
+// never edited or deleted, so the table is the user's full history.
+type Exclusion struct {
+	ID       int64      `json:"id"`
+	UserID   uint64     `json:"userId"`
+	Type     string     `json:"type"`
+	Reason   string     `json:"reason,omitempty"`
+	Actor    string     `json:"actor"`
+	StartsAt time.Time  `json:"startsAt"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"` // nil for a permanent exclusion
+	Active   bool       `json:"active"`
+}
+
+// CreateExclusion starts an exclusion now. A self-exclusion without a
+// duration is permanent; a time-out needs one, and the actor that applied it.
+// A self-exclusion's actor defaults to ActorAPI, as in the audit trail. An
+// exclusion cannot be lifted early, but a new one may extend it.
+func CreateExclusion(userID uint64, req ExclusionRequest) (*Exclusion, error) {
+	switch {
+	case req.Type != ExclusionSelf && req.Type != ExclusionTimeOut,
+		req.DurationSeconds < 0,
+		req.Type == ExclusionTimeOut && (req.DurationSeconds == 0 || req.Actor == ""):
+		return nil, ErrInvalidExclusion
+	}
+	actor := req.Actor
+	if actor == "" {
+		actor = ActorAPI
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Serialize with balance changes so none slips past a new exclusion
+	if _, err := lockUser(tx, userID); err != nil {
+		return nil, err
+	}
+
+	var duration interface{}
+	if req.DurationSeconds > 0 {
+		duration = req.DurationSeconds
+	}
+	e, err := scanExclusion(tx.QueryRow(`
+		INSERT INTO exclusions (user_id, exclusion_type, reason, actor, ends_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + $5 * INTERVAL '1 second')
+		RETURNING `+exclusionColumns,
+		userID, req.Type, nullString(req.Reason), actor, duration))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id":      userID,
+		"exclusion_id": e.ID,
+		"type":         e.Type,
+		"actor":        e.Actor,
+		"ends_at":      e.EndsAt,
+	}).Info("Created exclusion")
+
+	return e, nil
+}
+
+// ListExclusions returns the user's exclusions, newest first.
+func ListExclusions(userID uint64) ([]Exclusion, error) {
+	if err := ensureUserExists(userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+exclusionColumns+` FROM exclusions
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list exclusions: %w", err)
+	}
+	defer rows.Close()
+
+	exclusions := []Exclusion{}
+	for rows.Next() {
+		e, err := scanExclusion(rows)
+		if err != nil {
+			return nil, err
+		}
+		exclusions = append(exclusions, *e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list exclusions: %w", err)
+	}
+	return exclusions, nil
+}
+
+// checkExclusionTx rejects game stakes while the user has an active
+// exclusion. Withdrawals, payouts, captures of earlier holds and a closing
+// stake (EndRound) on a round opened before the exclusion still go through,
+// so open bets can settle. Callers hold the user row lock.
+func checkExclusionTx(tx *sql.Tx, in transactionInput) error {
+	if in.State != "lose" || in.SourceType != "game" || in.Capture {
+		return nil
+	}
+	excluded, err := isExcludedTx(tx, in.UserID)
+	if err != nil || !excluded {
+		return err
+	}
+	if in.RoundID != "" && in.EndRound {
+		// Only a round that was already open when the first active
+		// exclusion started; one opened since, say by a non-game stake,
+		// is not an open bet to settle
+		var open bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM rounds
+				WHERE round_id = $1 AND user_id = $2 AND status = $3 AND created_at < (
+					SELECT MIN(created_at) FROM exclusions
+					WHERE user_id = $2 AND (ends_at IS NULL OR ends_at > CURRENT_TIMESTAMP)
+				)
+			)`,
+			in.RoundID, in.UserID, RoundOpen).Scan(&open)
+		if err != nil {
+			return fmt.Errorf("failed to fetch round: %w", err)
+		}
+		if open {
+			return nil
+		}
+	}
+	return ErrExcluded
+}
+
+// isExcludedTx reports whether the user has an active exclusion.
+func isExcludedTx(tx *sql.Tx, userID uint64) (bool, error) {
+	var excluded bool
+	err := tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM exclusions
+			WHERE user_id = $1 AND (ends_at IS NULL OR ends_at > CURRENT_TIMESTAMP)
+		)`, userID).Scan(&excluded)
+	if err != nil {
+		return false, fmt.Errorf("failed to check exclusions: %w", err)
+	}
+	return excluded, nil
+}
+
+const exclusionColumns = `id, user_id, exclusion_type, COALESCE(reason, ''), actor, created_at, ends_at,
+		(ends_at IS NULL OR ends_at > CURRENT_TIMESTAMP)`
+
+func scanExclusion(row rowScanner) (*Exclusion, error) {
+	var e Exclusion
+	var endsAt sql.NullTime
+	err := row.Scan(&e.ID, &e.UserID, &e.Type, &e.Reason, &e.Actor, &e.StartsAt, &endsAt, &e.Active)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exclusion: %w", err)
+	}
+	e.StartsAt = e.StartsAt.UTC()
+	if endsAt.Valid {
+		t := endsAt.Time.UTC()
+		e.EndsAt = &t
+	}
+	return &e, nil
+}
@@ -0,0 +1,198 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	walletv1 "entain-app/api/wallet/v1"
+	"entain-app/pkg/utils"
+)
+
+// NewGRPCServer returns a gRPC server with the wallet service, the standard
+// health service (reporting SERVING) and server reflection registered.
+func NewGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(recoverInterceptor, loggingInterceptor))
+	walletv1.RegisterWalletServiceServer(srv, walletServer{})
+
+	healthSrv := health.NewServer()
+	healthSrv.SetServingStatus(walletv1.WalletService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, healthSrv)
+
+	reflection.Register(srv)
+	return srv
+}
+
+// walletServer implements WalletService on top of the same service calls,
+// validation and error mapping as the HTTP handlers.
+type walletServer struct {
+	walletv1.UnimplementedWalletServiceServer
+}
+
+func (walletServer) ProcessTransaction(ctx context.Context, in *walletv1.ProcessTransactionRequest) (*walletv1.ProcessTransactionResponse, error) {
+	if in.UserId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Invalid user ID")
+	}
+	if !utils.IsValidSourceType(in.SourceType) {
+		return nil, status.Error(codes.InvalidArgument, "Missing or invalid source type")
+	}
+	req := TransactionRequest{
+		State:         in.State,
+		Amount:        in.Amount,
+		TransactionID: in.TransactionId,
+		Currency:      in.Currency,
+		RoundID:       in.RoundId,
+		GameID:        in.GameId,
+		EndRound:      in.EndRound,
+	}
+	if msg := validateTransactionRequest(req); msg != "" {
+		return nil, status.Error(codes.InvalidArgument, msg)
+	}
+
+	result, err := ProcessTransaction(in.UserId, req, in.SourceType)
+	if err != nil {
+		return nil, transactionStatus(err)
+	}
+	resp := &walletv1.ProcessTransactionResponse{TransactionId: result.TransactionID, Replayed: result.Replayed}
+	if result.Balance != nil {
+		resp.Balance = result.Balance.String()
+	}
+	return resp, nil
+}
+
+func (walletServer) GetBalance(ctx context.Context, in *walletv1.GetBalanceRequest) (*walletv1.GetBalanceResponse, error) {
+	if in.UserId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Invalid user ID")
+	}
+	b, err := balanceResponse(in.UserId, in.Currency)
+	switch err {
+	case nil:
+	case ErrUserNotFound, ErrWalletNotFound:
+		return nil, status.Error(codes.NotFound, err.Error())
+	default:
+		return nil, status.Error(codes.Internal, "Failed to retrieve balance")
+	}
+
+	resp := &walletv1.GetBalanceResponse{
+		UserId:           b.UserID,
+		Currency:         b.Currency,
+		Balance:          b.Balance,
+		AvailableBalance: b.AvailableBalance,
+		ReservedBalance:  b.ReservedBalance,
+		CashBalance:      b.CashBalance,
+		BonusBalance:     b.BonusBalance,
+	}
+	for _, w := range b.Wallets {
+		resp.Wallets = append(resp.Wallets, &walletv1.Wallet{
+			Currency:         w.Currency,
+			Balance:          w.Balance,
+			AvailableBalance: w.AvailableBalance,
+			ReservedBalance:  w.ReservedBalance,
+			CashBalance:      w.CashBalance,
+			BonusBalance:     w.BonusBalance,
+			WageringRequired: w.WageringRequired,
+			WageringProgress: w.WageringProgress,
+		})
+	}
+	return resp, nil
+}
+
+func (walletServer) GetTransaction(ctx context.Context, in *walletv1.GetTransactionRequest) (*walletv1.Transaction, error) {
+	if in.UserId == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Invalid user ID")
+	}
+	t, err := GetTransaction(in.UserId, in.TransactionId)
+	switch err {
+	case nil:
+	case ErrTransactionNotFound:
+		return nil, status.Error(codes.NotFound, err.Error())
+	default:
+		return nil, status.Error(codes.Internal, "Failed to retrieve transaction")
+	}
+
+	return &walletv1.Transaction{
+		TransactionId:         t.TransactionID,
+		UserId:                t.UserID,
+		Amount:                t.Amount.String(),
+		State:                 t.State,
+		SourceType:            t.SourceType,
+		Currency:              t.Currency,
+		BalanceAfter:          optionalMoney(t.BalanceAfter),
+		CashAmount:            optionalMoney(t.CashAmount),
+		BonusAmount:           optionalMoney(t.BonusAmount),
+		RoundId:               t.RoundID,
+		GameId:                t.GameID,
+		CreatedAt:             timestamppb.New(t.CreatedAt),
+		ReversesTransactionId: t.ReversesTransactionID,
+		ReversedBy:            t.ReversedBy,
+	}, nil
+}
+
+// optionalMoney formats m, or returns "" for nil.
+func optionalMoney(m *Money) string {
+	if m == nil {
+		return ""
+	}
+	return m.String()
+}
+
+// transactionStatus maps a ProcessTransaction error to the gRPC status
+// matching the HTTP status transactionError answers with.
+func transactionStatus(err error) error {
+	httpStatus, body := transactionError(err)
+	msg := "Internal server error"
+	switch b := body.(type) {
+	case utils.ErrorResponse:
+		msg = b.Error
+	case ConflictResponse:
+		msg = b.Error
+	case LimitExceededResponse:
+		msg = b.Error
+	}
+
+	code := codes.Internal
+	switch httpStatus {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.Aborted
+	}
+	return status.Error(code, msg)
+}
+
+// recoverInterceptor turns a panicking call into an Internal error, like
+// utils.RecoverMiddleware does for HTTP.
+func recoverInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			utils.Logger.WithField("panic", rec).Error("Panic recovered")
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// loggingInterceptor logs method, status code and duration, like
+// utils.LoggingMiddleware does for HTTP.
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	utils.Logger.WithFields(map[string]interface{}{
+		"method":   info.FullMethod,
+		"code":     status.Code(err).String(),
+		"duration": time.Since(start).Milliseconds(), // in ms
+	}).Info("Handled gRPC request")
+	return resp, err
+}
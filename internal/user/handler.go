@@ -1,9 +1,17 @@
 package user
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"entain-app/pkg/utils"
 
@@ -22,7 +30,7 @@ func HandleTransaction(w http.ResponseWriter, r *http.Request) {
 	// Validate Source-Type header
 	sourceType := r.Header.Get("Source-Type")
 	if sourceType == "" || !utils.IsValidSourceType(sourceType) {
-		utils.WriteError(w, http.StatusBadRequest, "Missing or invalid Source-Type header")
+		utils.WriteError(w, http.StatusBadRequest, utils.InvalidSourceTypeMessage)
 		return
 	}
 
@@ -34,34 +42,470 @@ func HandleTransaction(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Validate transaction state and amount precision
-	if !utils.IsValidState(req.State) {
-		utils.WriteError(w, http.StatusBadRequest, "Invalid state: must be 'win' or 'lose'")
+	if msg := validateTransactionRequest(req); msg != "" {
+		utils.WriteError(w, http.StatusBadRequest, msg)
 		return
 	}
 
-	if !utils.IsValidAmountFormat(req.Amount) {
-		utils.WriteError(w, http.StatusBadRequest, "Amount must have at most 2 decimal places")
+	// Prefer: respond-async queues the transaction instead of applying it
+	if strings.Contains(r.Header.Get("Prefer"), "respond-async") {
+		handleAsyncTransaction(w, r, userID, req, sourceType)
 		return
 	}
 
 	// Process the transaction
-	err = ProcessTransaction(userID, req, sourceType)
+	result, err := ProcessTransaction(userID, req, sourceType)
+	if err != nil {
+		status, body := transactionError(err)
+		utils.WriteJSON(w, status, body)
+		return
+	}
+
+	// Exact replays get the original response back
+	if result.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	utils.WriteSuccess(w, http.StatusOK, newTransactionResponse(result))
+}
+
+// handleAsyncTransaction queues a validated transaction and answers 202 with
+// the URL to poll. An optional Callback-URL header, an https URL on one of
+// the ASYNC_CALLBACK_HOSTS, gets the outcome POSTed.
+func handleAsyncTransaction(w http.ResponseWriter, r *http.Request, userID uint64, req TransactionRequest, sourceType string) {
+	callback := r.Header.Get("Callback-URL")
+	if callback != "" && !IsAllowedCallbackURL(callback) {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid Callback-URL header")
+		return
+	}
+
+	queued, err := EnqueueTransaction(userID, req, sourceType, callback)
+	if err != nil {
+		status, body := transactionError(err)
+		utils.WriteJSON(w, status, body)
+		return
+	}
+
+	statusURL := fmt.Sprintf("/user/%d/transaction/%s/status", userID, url.PathEscape(queued.TransactionID))
+	if queued.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	w.Header().Set("Location", statusURL)
+	utils.WriteJSON(w, http.StatusAccepted, AsyncTransactionResponse{
+		Message:       "Transaction accepted",
+		TransactionID: queued.TransactionID,
+		Status:        queued.Status,
+		StatusURL:     statusURL,
+	})
+}
+
+// HandleQueuedTransactionStatus returns the status of a transaction queued
+// with Prefer: respond-async, and its outcome once finished.
+func HandleQueuedTransactionStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	queued, err := GetQueuedTransaction(userID, vars["transactionId"])
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, queued)
+	case ErrQueuedNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve transaction status")
+	}
+}
+
+// validateTransactionRequest returns a client-facing message for the first
+// invalid field of a transaction request, or "" if there is none.
+func validateTransactionRequest(req TransactionRequest) string {
+	if !utils.IsValidState(req.State) {
+		return utils.InvalidStateMessage
+	}
+	if !utils.IsValidAmountFormat(req.Amount) {
+		return utils.InvalidAmountMessage
+	}
+	if req.RoundID == "" && (req.GameID != "" || req.EndRound) {
+		return "gameId and endRound require a roundId"
+	}
+	if isReservedTransactionID(req.TransactionID) {
+		return ErrReservedTransactionID.Error()
+	}
+	return ""
+}
+
+// transactionError maps a ProcessTransaction error to the status and body
+// the transaction endpoints answer with.
+func transactionError(err error) (int, interface{}) {
+	// Same ID with a different payload: report what differs
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		return http.StatusConflict, ConflictResponse{
+			Error:         conflict.Error(),
+			TransactionID: conflict.TransactionID,
+			Mismatches:    conflict.Mismatches,
+		}
+	}
+	var exceeded *LimitExceededError
+	if errors.As(err, &exceeded) {
+		return http.StatusForbidden, newLimitExceededResponse(exceeded)
+	}
+
+	switch err {
+	case ErrInvalidAmount, ErrAmountOverflow, ErrInsufficientBalance, ErrInsufficientCash,
+		ErrUnsupportedCurrency, ErrAmountPrecision, ErrWalletNotFound, ErrReservedTransactionID:
+		return http.StatusBadRequest, utils.ErrorResponse{Error: err.Error()}
+	case ErrUserNotFound:
+		return http.StatusNotFound, utils.ErrorResponse{Error: err.Error()}
+	case ErrRoundNotOpen, ErrRoundCurrency, ErrQueueConflict:
+		return http.StatusConflict, utils.ErrorResponse{Error: err.Error()}
+	case ErrAccountNotActive, ErrExcluded:
+		return http.StatusForbidden, utils.ErrorResponse{Error: err.Error()}
+	default:
+		return http.StatusInternalServerError, utils.ErrorResponse{Error: "Internal server error"}
+	}
+}
+
+// writeLimitExceeded answers a *LimitExceededError with the limit that was
+// hit and reports whether it did.
+func writeLimitExceeded(w http.ResponseWriter, err error) bool {
+	var exceeded *LimitExceededError
+	if !errors.As(err, &exceeded) {
+		return false
+	}
+	utils.WriteJSON(w, http.StatusForbidden, newLimitExceededResponse(exceeded))
+	return true
+}
+
+func newLimitExceededResponse(e *LimitExceededError) LimitExceededResponse {
+	return LimitExceededResponse{
+		Error:     e.Error(),
+		LimitType: e.Type,
+		Period:    e.Period,
+		Currency:  e.Currency,
+		Limit:     e.Limit.String(),
+		Used:      e.Used.String(),
+	}
+}
+
+// HandleBatch applies many transactions in one call. Each item is validated
+// and answered like a call to HandleTransaction; in atomic mode any failing
+// item rolls back the whole batch and the response is 422.
+func HandleBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if req.Mode != BatchAtomic && req.Mode != BatchBestEffort {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid mode: must be 'atomic' or 'best_effort'")
+		return
+	}
+	if len(req.Items) == 0 || len(req.Items) > MaxBatchSize {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Batch must have 1 to %d items", MaxBatchSize))
+		return
+	}
+	atomic := req.Mode == BatchAtomic
+
+	// Validate each item as HandleTransaction would; only valid ones are processed
+	results := make([]BatchItemResult, len(req.Items))
+	var valid []BatchItem
+	var indexes []int
+	seen := make(map[string]bool)
+	for i, item := range req.Items {
+		if item.SourceType == "" {
+			item.SourceType = r.Header.Get("Source-Type")
+		}
+		msg := validateTransactionRequest(item.TransactionRequest)
+		switch {
+		case item.UserID == 0:
+			msg = "Invalid user ID"
+		case item.SourceType == "" || !utils.IsValidSourceType(item.SourceType):
+			msg = "Missing or invalid sourceType"
+		case seen[item.TransactionID]:
+			msg = "Duplicate transactionId in batch"
+		}
+		seen[item.TransactionID] = true
+		if msg != "" {
+			results[i] = BatchItemResult{Index: i, Status: http.StatusBadRequest, Body: utils.ErrorResponse{Error: msg}}
+			continue
+		}
+		valid = append(valid, item)
+		indexes = append(indexes, i)
+	}
+
+	// An atomic batch with an invalid item is rejected without touching the DB
+	if atomic && len(valid) < len(req.Items) {
+		for _, i := range indexes {
+			results[i] = batchErrorResult(i, ErrBatchRolledBack)
+		}
+		utils.WriteJSON(w, http.StatusUnprocessableEntity, BatchResponse{Mode: req.Mode, Results: results})
+		return
+	}
+
+	committed := true
+	for n, outcome := range ProcessBatch(valid, atomic) {
+		i := indexes[n]
+		if outcome.Err != nil {
+			results[i] = batchErrorResult(i, outcome.Err)
+			committed = !atomic
+			continue
+		}
+		results[i] = BatchItemResult{
+			Index:    i,
+			Status:   http.StatusOK,
+			Replayed: outcome.Result.Replayed,
+			Body:     newTransactionResponse(outcome.Result),
+		}
+	}
+
+	status := http.StatusOK
+	if !committed {
+		status = http.StatusUnprocessableEntity
+	}
+	utils.WriteJSON(w, status, BatchResponse{Mode: req.Mode, Committed: committed, Results: results})
+}
+
+// MaxStreamLineBytes bounds one line of an NDJSON upload.
+const MaxStreamLineBytes = 64 << 10
+
+var errLineTooLong = errors.New("line too long")
+
+// HandleTransactionStream applies an NDJSON upload of batch items, one per
+// line, and streams back one NDJSON result line per input line as it goes.
+// Lines are read, applied and answered one at a time, so memory use does
+// not grow with the upload. Items are validated, applied and answered like
+// calls to HandleTransaction; sourceType defaults to the Source-Type header.
+func HandleTransactionStream(w http.ResponseWriter, r *http.Request) {
+	// Answer while the upload is still being read
+	rc := http.NewResponseController(w)
+	if err := rc.EnableFullDuplex(); err != nil {
+		utils.Logger.WithError(err).Warn("Full duplex not supported")
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	defaultSource := r.Header.Get("Source-Type")
+	reader := bufio.NewReaderSize(r.Body, 32<<10)
+	enc := json.NewEncoder(w)
+	for lineNo := 1; ; lineNo++ {
+		line, err := readLine(reader, MaxStreamLineBytes)
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF && err != errLineTooLong {
+			utils.Logger.WithError(err).Warn("Stream upload interrupted")
+			break
+		}
+
+		var res StreamResult
+		if err == errLineTooLong {
+			res = StreamResult{
+				Status: http.StatusRequestEntityTooLarge,
+				Body:   utils.ErrorResponse{Error: fmt.Sprintf("Line exceeds %d bytes", MaxStreamLineBytes)},
+			}
+		} else if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		} else {
+			res = applyStreamLine(line, defaultSource)
+		}
+		res.Line = lineNo
+		if err := enc.Encode(res); err != nil {
+			utils.Logger.WithError(err).Warn("Stream client went away")
+			return
+		}
+		// Flush once the lines already received are answered
+		if reader.Buffered() == 0 {
+			rc.Flush()
+		}
+	}
+	rc.Flush()
+}
+
+// applyStreamLine validates and applies one NDJSON line.
+func applyStreamLine(line []byte, defaultSource string) StreamResult {
+	var item BatchItem
+	if err := json.Unmarshal(line, &item); err != nil {
+		return StreamResult{Status: http.StatusBadRequest, Body: utils.ErrorResponse{Error: "Invalid JSON line"}}
+	}
+	res := StreamResult{TransactionID: item.TransactionID}
+	if item.SourceType == "" {
+		item.SourceType = defaultSource
+	}
+
+	msg := validateTransactionRequest(item.TransactionRequest)
+	switch {
+	case item.UserID == 0:
+		msg = "Invalid user ID"
+	case item.SourceType == "" || !utils.IsValidSourceType(item.SourceType):
+		msg = "Missing or invalid sourceType"
+	}
+	if msg != "" {
+		res.Status, res.Body = http.StatusBadRequest, utils.ErrorResponse{Error: msg}
+		return res
+	}
+
+	result, err := ProcessTransaction(item.UserID, item.TransactionRequest, item.SourceType)
+	if err != nil {
+		res.Status, res.Body = transactionError(err)
+		return res
+	}
+	res.Status, res.Replayed, res.Body = http.StatusOK, result.Replayed, newTransactionResponse(result)
+	return res
+}
+
+// readLine returns the next line without its newline. A line longer than
+// max is skipped up to its newline and reported as errLineTooLong, so the
+// stream stays in sync.
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > max+1 {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if tooLong && (err == nil || err == io.EOF) {
+			return nil, errLineTooLong
+		}
+		return bytes.TrimRight(line, "\r\n"), err
+	}
+}
+
+func batchErrorResult(index int, err error) BatchItemResult {
+	if err == ErrBatchRolledBack {
+		return BatchItemResult{Index: index, Status: http.StatusFailedDependency, Body: utils.ErrorResponse{Error: err.Error()}}
+	}
+	status, body := transactionError(err)
+	return BatchItemResult{Index: index, Status: status, Body: body}
+}
+
+func newTransactionResponse(result *TransactionResult) TransactionResponse {
+	resp := TransactionResponse{Message: "Transaction processed", TransactionID: result.TransactionID}
+	if result.Balance != nil {
+		resp.Balance = result.Balance.String()
+	}
+	return resp
+}
+
+// HandleBalance returns the user's wallets. The optional currency query
+// parameter narrows the response to one wallet.
+func HandleBalance(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	resp, err := balanceResponse(userID, r.URL.Query().Get("currency"))
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, resp)
+	case ErrUserNotFound, ErrWalletNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve balance")
+	}
+}
+
+// balanceResponse lists the user's wallets, or the one in currency if set.
+func balanceResponse(userID uint64, currency string) (*BalanceResponse, error) {
+	wallets, err := ListWallets(userID, currency)
+	if err == nil && len(wallets) == 0 {
+		err = ErrWalletNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Top-level fields show the default currency unless one was asked for
+	primary := wallets[0].Response()
+	resp := &BalanceResponse{UserID: userID, Wallets: make([]WalletResponse, 0, len(wallets))}
+	for _, wallet := range wallets {
+		wr := wallet.Response()
+		if currency == "" && wallet.Currency == DefaultCurrency() {
+			primary = wr
+		}
+		resp.Wallets = append(resp.Wallets, wr)
+	}
+	resp.Currency = primary.Currency
+	resp.Balance = primary.Balance
+	resp.AvailableBalance = primary.AvailableBalance
+	resp.ReservedBalance = primary.ReservedBalance
+	resp.CashBalance = primary.CashBalance
+	resp.BonusBalance = primary.BonusBalance
+	return resp, nil
+}
+
+// HandleGrantBonus credits promotion funds to the bonus sub-balance.
+func HandleGrantBonus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req BonusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if req.TransactionID == "" {
+		utils.WriteError(w, http.StatusBadRequest, "transactionId is required")
+		return
+	}
+	if !utils.IsValidAmountFormat(req.Amount) || !utils.IsValidAmountFormat(req.WageringRequirement) {
+		utils.WriteError(w, http.StatusBadRequest, utils.InvalidAmountMessage)
+		return
+	}
+
+	result, err := GrantBonus(userID, req)
+
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		utils.WriteJSON(w, http.StatusConflict, ConflictResponse{
+			Error:         conflict.Error(),
+			TransactionID: conflict.TransactionID,
+			Mismatches:    conflict.Mismatches,
+		})
+		return
+	}
+
 	switch err {
 	case nil:
-		utils.WriteSuccess(w, http.StatusOK, TransactionResponse{Message: "Transaction processed"})
-	case ErrDuplicateTransaction:
-		utils.WriteSuccess(w, http.StatusOK, TransactionResponse{Message: "Transaction already processed"})
-	case ErrInvalidAmount, ErrInsufficientBalance:
+		if result.Replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		resp := newTransactionResponse(result)
+		resp.Message = "Bonus granted"
+		utils.WriteSuccess(w, http.StatusOK, resp)
+	case ErrInvalidAmount, ErrAmountOverflow, ErrInvalidWagering,
+		ErrUnsupportedCurrency, ErrAmountPrecision, ErrWalletNotFound, ErrReservedTransactionID:
 		utils.WriteError(w, http.StatusBadRequest, err.Error())
 	case ErrUserNotFound:
 		utils.WriteError(w, http.StatusNotFound, err.Error())
+	case ErrAccountNotActive:
+		utils.WriteError(w, http.StatusForbidden, err.Error())
 	default:
 		utils.WriteError(w, http.StatusInternalServerError, "Internal server error")
 	}
 }
 
-// HandleBalance returns the current balance for the given user.
-func HandleBalance(w http.ResponseWriter, r *http.Request) {
+// HandleOpenWallet opens a wallet in another currency. Opening an existing
+// wallet returns it unchanged.
+func HandleOpenWallet(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
 	if err != nil || userID == 0 {
@@ -69,19 +513,827 @@ func HandleBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := GetUserBalance(userID)
-	if err != nil {
-		if err == ErrUserNotFound {
-			utils.WriteError(w, http.StatusNotFound, err.Error())
-		} else {
-			utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve balance")
+	var req WalletRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if req.Currency == "" {
+		utils.WriteError(w, http.StatusBadRequest, "currency is required")
+		return
+	}
+
+	wallet, created, err := OpenWallet(userID, req.Currency)
+	switch err {
+	case nil:
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		utils.WriteJSON(w, status, wallet.Response())
+	case ErrUnsupportedCurrency:
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+	case ErrAccountNotActive:
+		utils.WriteError(w, http.StatusForbidden, err.Error())
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to open wallet")
+	}
+}
+
+// HandleGetTransaction returns the stored outcome of a single transaction.
+func HandleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	txn, err := GetTransaction(userID, vars["transactionId"])
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, txn)
+	case ErrTransactionNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve transaction")
+	}
+}
+
+// HandleReverseTransaction writes a compensating entry for a stored transaction.
+func HandleReverseTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	result, err := ReverseTransaction(userID, vars["transactionId"])
+	switch err {
+	case nil:
+		resp := newTransactionResponse(result)
+		resp.Message = "Transaction reversed"
+		utils.WriteSuccess(w, http.StatusOK, resp)
+	case ErrAlreadyReversed, ErrNotReversible, ErrTransferLeg:
+		utils.WriteError(w, http.StatusConflict, err.Error())
+	case ErrInsufficientBalance, ErrAmountOverflow:
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+	case ErrUserNotFound, ErrTransactionNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// HandleCreateTransfer moves cash between two users' wallets atomically.
+func HandleCreateTransfer(w http.ResponseWriter, r *http.Request) {
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if req.TransferID == "" {
+		utils.WriteError(w, http.StatusBadRequest, "transferId is required")
+		return
+	}
+	if !utils.IsValidAmountFormat(req.Amount) {
+		utils.WriteError(w, http.StatusBadRequest, utils.InvalidAmountMessage)
+		return
+	}
+
+	transfer, err := CreateTransfer(req)
+	switch err {
+	case nil:
+		status := http.StatusCreated
+		if transfer.Replayed {
+			status = http.StatusOK
+			w.Header().Set("Idempotent-Replayed", "true")
 		}
+		utils.WriteJSON(w, status, transfer)
+	case ErrInvalidTransfer, ErrInvalidAmount, ErrAmountOverflow, ErrInsufficientBalance, ErrInsufficientCash,
+		ErrUnsupportedCurrency, ErrAmountPrecision, ErrWalletNotFound:
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+	case ErrTransferConflict:
+		utils.WriteError(w, http.StatusConflict, err.Error())
+	case ErrAccountNotActive:
+		utils.WriteError(w, http.StatusForbidden, err.Error())
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// HandleGetTransfer returns a stored transfer.
+func HandleGetTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, err := GetTransfer(mux.Vars(r)["transferId"])
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, transfer)
+	case ErrTransferNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve transfer")
+	}
+}
+
+// HandleGetRound returns a game round with its stake, payout and net result.
+func HandleGetRound(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
-	resp := BalanceResponse{
-		UserID:  user.ID,
-		Balance: strconv.FormatFloat(user.Balance, 'f', 2, 64),
+	round, err := GetRound(userID, vars["roundId"])
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, round)
+	case ErrRoundNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve round")
+	}
+}
+
+// HandleAuthorizeReservation holds funds for a pending bet.
+func HandleAuthorizeReservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	sourceType := r.Header.Get("Source-Type")
+	if sourceType == "" || !utils.IsValidSourceType(sourceType) {
+		utils.WriteError(w, http.StatusBadRequest, utils.InvalidSourceTypeMessage)
+		return
+	}
+
+	var req ReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if req.ReservationID == "" {
+		utils.WriteError(w, http.StatusBadRequest, "reservationId is required")
+		return
+	}
+	if !utils.IsValidAmountFormat(req.Amount) {
+		utils.WriteError(w, http.StatusBadRequest, utils.InvalidAmountMessage)
+		return
+	}
+
+	res, err := AuthorizeReservation(userID, req, sourceType)
+	if writeLimitExceeded(w, err) {
+		return
+	}
+	switch err {
+	case nil:
+		status := http.StatusCreated
+		if res.Replayed {
+			status = http.StatusOK
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		utils.WriteJSON(w, status, res)
+	case ErrInvalidAmount, ErrAmountOverflow, ErrInsufficientBalance, ErrInsufficientCash, ErrInvalidTTL,
+		ErrUnsupportedCurrency, ErrAmountPrecision, ErrWalletNotFound:
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+	case ErrReservationConflict:
+		utils.WriteError(w, http.StatusConflict, err.Error())
+	case ErrAccountNotActive, ErrExcluded:
+		utils.WriteError(w, http.StatusForbidden, err.Error())
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// HandleCaptureReservation finalizes a held reservation as a debit.
+func HandleCaptureReservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	result, err := CaptureReservation(userID, vars["reservationId"])
+	if writeLimitExceeded(w, err) {
+		return
+	}
+	switch err {
+	case nil:
+		if result.Replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		resp := newTransactionResponse(result)
+		resp.Message = "Reservation captured"
+		utils.WriteSuccess(w, http.StatusOK, resp)
+	case ErrReservationNotHeld, ErrReservationExpired, ErrDuplicateTransaction:
+		utils.WriteError(w, http.StatusConflict, err.Error())
+	case ErrAccountNotActive:
+		utils.WriteError(w, http.StatusForbidden, err.Error())
+	case ErrInsufficientBalance, ErrInsufficientCash, ErrAmountOverflow:
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+	case ErrUserNotFound, ErrReservationNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// HandleReleaseReservation returns held funds to the available balance.
+func HandleReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	res, err := ReleaseReservation(userID, vars["reservationId"])
+	switch err {
+	case nil:
+		if res.Replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
+		utils.WriteJSON(w, http.StatusOK, res)
+	case ErrReservationNotHeld:
+		utils.WriteError(w, http.StatusConflict, err.Error())
+	case ErrUserNotFound, ErrReservationNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// HandleGetReservation returns the current state of a reservation.
+func HandleGetReservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	res, err := GetReservation(userID, vars["reservationId"])
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, res)
+	case ErrReservationNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve reservation")
+	}
+}
+
+// HandleCreateUser opens a new account with a zero balance.
+func HandleCreateUser(w http.ResponseWriter, r *http.Request) {
+	account, err := CreateAccount()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+	w.Header().Set("Location", "/user/"+strconv.FormatUint(account.UserID, 10))
+	utils.WriteJSON(w, http.StatusCreated, account)
+}
+
+// HandleGetUser returns account details and status.
+func HandleGetUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	account, err := GetAccount(userID)
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, account)
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve user")
+	}
+}
+
+// HandleUpdateUserStatus suspends, reactivates or closes an account.
+func HandleUpdateUserStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req AccountStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	account, err := UpdateAccountStatus(userID, req.Status)
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, account)
+	case ErrInvalidStatus:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid status: must be 'active', 'suspended' or 'closed'")
+	case ErrAccountClosed, ErrAccountHasFunds:
+		utils.WriteError(w, http.StatusConflict, err.Error())
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to update user")
+	}
+}
+
+// HandleListLimits returns the user's limits with their usage and any
+// pending change.
+func HandleListLimits(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	limits, err := ListLimits(userID)
+	switch err {
+	case nil:
+		if limits == nil {
+			limits = []Limit{}
+		}
+		utils.WriteJSON(w, http.StatusOK, limits)
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve limits")
+	}
+}
+
+// HandleSetLimit sets a limit. Decreases apply at once; increases are
+// returned with the pending amount and when it takes effect.
+func HandleSetLimit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req LimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if !utils.IsValidAmountFormat(req.Amount) {
+		utils.WriteError(w, http.StatusBadRequest, utils.InvalidAmountMessage)
+		return
+	}
+
+	limit, err := SetLimit(userID, req)
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, limit)
+	case ErrInvalidLimit:
+		utils.WriteError(w, http.StatusBadRequest,
+			"Invalid limit: type must be 'deposit', 'loss' or 'wager' and period 'daily', 'weekly' or 'monthly'")
+	case ErrInvalidAmount, ErrAmountOverflow, ErrUnsupportedCurrency, ErrAmountPrecision:
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to set limit")
+	}
+}
+
+// HandleRemoveLimit schedules a limit's removal after the cooling-off period.
+// The optional currency query parameter picks a non-default currency.
+func HandleRemoveLimit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	limit, err := RemoveLimit(userID, vars["limitType"], vars["period"], r.URL.Query().Get("currency"))
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, limit)
+	case ErrInvalidLimit:
+		utils.WriteError(w, http.StatusBadRequest,
+			"Invalid limit: type must be 'deposit', 'loss' or 'wager' and period 'daily', 'weekly' or 'monthly'")
+	case ErrUserNotFound, ErrLimitNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to remove limit")
+	}
+}
+
+// HandleCreateExclusion starts a self-exclusion or a support time-out.
+func HandleCreateExclusion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req ExclusionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	exclusion, err := CreateExclusion(userID, req)
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusCreated, exclusion)
+	case ErrInvalidExclusion:
+		utils.WriteError(w, http.StatusBadRequest,
+			"Invalid exclusion: type must be 'self_exclusion' or 'time_out', and a time_out needs a positive durationSeconds and an actor")
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to create exclusion")
+	}
+}
+
+// HandleListExclusions returns the user's exclusion history, newest first.
+func HandleListExclusions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	exclusions, err := ListExclusions(userID)
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, exclusions)
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve exclusions")
+	}
+}
+
+// HandleTransactionHistory lists the user's transactions with cursor pagination.
+// Supported query parameters: limit, cursor, state, sourceType, currency,
+// minAmount, maxAmount, from and to (RFC 3339).
+func HandleTransactionHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	filter, msg := parseTransactionFilter(r)
+	if msg != "" {
+		utils.WriteError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	txns, next, err := ListTransactions(userID, filter)
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, TransactionHistoryResponse{Transactions: txns, NextCursor: next})
+	case ErrInvalidCursor:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid cursor")
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve transactions")
+	}
+}
+
+// parseTransactionFilter reads history filters from the query string and
+// returns a client-facing message for the first invalid one.
+func parseTransactionFilter(r *http.Request) (TransactionFilter, string) {
+	q := r.URL.Query()
+	f := TransactionFilter{
+		State:      q.Get("state"),
+		SourceType: q.Get("sourceType"),
+		Currency:   q.Get("currency"),
+		Cursor:     q.Get("cursor"),
+	}
+
+	if f.State != "" && !utils.IsValidState(f.State) {
+		return f, utils.InvalidStateMessage
+	}
+	if f.SourceType != "" && !utils.IsValidSourceType(f.SourceType) {
+		return f, "Invalid sourceType: must be 'game', 'server' or 'payment'"
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return f, "Invalid limit"
+		}
+		f.Limit = limit
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **Money
+	}{{"minAmount", &f.MinAmount}, {"maxAmount", &f.MaxAmount}} {
+		if v := q.Get(p.name); v != "" {
+			m, err := ParseMoney(v)
+			if err != nil || !utils.IsValidAmountFormat(v) {
+				return f, "Invalid " + p.name
+			}
+			*p.dst = &m
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, "Invalid " + p.name + ": must be RFC 3339"
+			}
+			*p.dst = &t
+		}
+	}
+
+	return f, ""
+}
+
+// HandleBalanceAudit returns a page of the user's balance audit trail,
+// newest first. Accepts currency, limit and cursor.
+func HandleBalanceAudit(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := AuditFilter{Currency: q.Get("currency"), Cursor: q.Get("cursor")}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, next, err := ListBalanceAudit(userID, filter)
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, BalanceAuditResponse{Entries: entries, NextCursor: next})
+	case ErrInvalidCursor:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid cursor")
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve balance audit")
+	}
+}
+
+// HandleBalanceStream streams the user's balance events as server-sent
+// events, from whichever server instance committed them. Each event's id is
+// its outbox event ID; a client reconnecting with Last-Event-ID receives
+// the events it missed. Without one the stream starts at the next change.
+// A comment line is sent when the stream has been idle for a heartbeat.
+func HandleBalanceStream(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.ParseUint(vars["userId"], 10, 64)
+	if err != nil || userID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var lastID int64
+	resume := r.Header.Get("Last-Event-ID")
+	if resume != "" {
+		lastID, err = strconv.ParseInt(resume, 10, 64)
+		if err != nil || lastID < 0 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+	}
+
+	switch err := ensureUserExists(userID); err {
+	case nil:
+	case ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+		return
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to open balance stream")
+		return
+	}
+
+	// Subscribe before reading, so that no change falls in between
+	wake, unsubscribe := balanceStreams.subscribe(userID)
+	defer unsubscribe()
+	if resume == "" {
+		if lastID, err = latestEventID(userID); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to open balance stream")
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, ": connected\n\n")
+	rc.Flush()
+
+	heartbeat := time.NewTicker(balanceStreamCfg.Heartbeat)
+	defer heartbeat.Stop()
+	log := utils.Logger.WithField("user_id", userID)
+	for {
+		// Send everything after lastID, then wait for the next change
+		for {
+			events, err := eventsAfter(userID, lastID, balanceStreamBatch)
+			if err != nil {
+				log.WithError(err).Error("Balance stream failed")
+				return
+			}
+			for _, e := range events {
+				data, err := json.Marshal(e)
+				if err != nil {
+					log.WithError(err).Error("Failed to encode balance event")
+					return
+				}
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+					return // client went away
+				}
+				lastID = e.ID
+			}
+			if len(events) > 0 {
+				rc.Flush()
+				heartbeat.Reset(balanceStreamCfg.Heartbeat)
+			}
+			if len(events) < balanceStreamBatch {
+				break
+			}
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-balanceStreams.stopped:
+			return
+		case <-wake:
+		case <-heartbeat.C:
+			// Also catches changes whose notification was lost
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
+
+// HandleCreateWebhook subscribes a URL to events. The response carries the
+// signing secret, which is not shown again.
+func HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	webhook, err := CreateWebhook(req)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, webhook)
+}
+
+// HandleListWebhooks returns every webhook subscription.
+func HandleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := ListWebhooks()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve webhooks")
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, webhooks)
+}
+
+// HandleGetWebhook returns one webhook subscription.
+func HandleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+	webhook, err := GetWebhook(id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, webhook)
+}
+
+// HandleUpdateWebhook replaces a webhook subscription's settings.
+func HandleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	webhook, err := UpdateWebhook(id, req)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, webhook)
+}
+
+// HandleDeleteWebhook removes a webhook subscription.
+func HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+	if err := DeleteWebhook(id); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleWebhookDeliveries returns a page of a webhook's delivery log, newest
+// first. Accepts status, limit and cursor.
+func HandleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseWebhookID(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", DeliveryPending, DeliveryDelivered, DeliveryDead:
+	default:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid status: must be 'pending', 'delivered' or 'dead'")
+		return
+	}
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	deliveries, next, err := ListWebhookDeliveries(id, status, q.Get("cursor"), limit)
+	switch err {
+	case nil:
+		utils.WriteJSON(w, http.StatusOK, WebhookDeliveriesResponse{Deliveries: deliveries, NextCursor: next})
+	case ErrInvalidCursor:
+		utils.WriteError(w, http.StatusBadRequest, "Invalid cursor")
+	default:
+		writeWebhookError(w, err)
+	}
+}
+
+func parseWebhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["webhookId"], 10, 64)
+	if err != nil || id <= 0 {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// writeWebhookError maps a webhook service error to a response.
+func writeWebhookError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrInvalidWebhookURL, ErrInvalidWebhookEvent, ErrWebhookThreshold, ErrInvalidAmount, ErrAmountOverflow,
+		ErrUnsupportedCurrency, ErrAmountPrecision:
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+	case ErrWebhookNotFound, ErrUserNotFound:
+		utils.WriteError(w, http.StatusNotFound, err.Error())
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, "Internal server error")
 	}
-	utils.WriteJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,143 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+var ErrTransactionConflict = errors.New("transaction ID already used with a different payload")
+
+// FieldMismatch describes one field that differs from the original request.
+type FieldMismatch struct {
+	Field    string `json:"field"`
+	Original string `json:"original"`
+	Received string `json:"received"`
+}
+
+// ConflictError is returned when a transaction ID is reused with a payload
+// that does not match the stored original.
+type ConflictError struct {
+	TransactionID string
+	Mismatches    []FieldMismatch
+}
+
+func (e *ConflictError) Error() string { return ErrTransactionConflict.Error() }
+
+func (e *ConflictError) Is(target error) bool { return target == ErrTransactionConflict }
+
+// TransactionResult is the outcome of ProcessTransaction. Replayed is set
+// when the transaction ID had already been applied with the same payload.
+type TransactionResult struct {
+	TransactionID string
+	Balance       *Money
+	Replayed      bool
+}
+
+// requestFingerprint hashes the fields that define a transaction so replays
+// can be told apart from conflicting reuse of the same ID. Round fields,
+// endRound and non-default currencies are only mixed in when present, keeping
+// older fingerprints stable.
+func requestFingerprint(in transactionInput) string {
+	raw := fmt.Sprintf("%d|%s|%s|%s", in.UserID, in.Amount, in.State, in.SourceType)
+	if in.Currency != "" && in.Currency != DefaultCurrency() {
+		raw += "|" + in.Currency
+	}
+	if in.RoundID != "" || in.GameID != "" {
+		raw += fmt.Sprintf("|%s|%s", in.RoundID, in.GameID)
+	}
+	if in.EndRound {
+		raw += "|endRound"
+	}
+	if in.Bonus {
+		raw += fmt.Sprintf("|bonus|%s", in.Wagering)
+	}
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// storedTransaction is the subset of a transactions row needed to decide
+// between replay and conflict.
+type storedTransaction struct {
+	TransactionID string
+	UserID        uint64
+	Amount        Money
+	State         string
+	SourceType    string
+	Currency      string
+	RoundID       string
+	GameID        string
+	EndRound      bool
+	Bonus         bool
+	Wagering      Money
+	Fingerprint   string
+	BalanceAfter  *Money
+}
+
+// input rebuilds the request that produced the stored row.
+func (t *storedTransaction) input() transactionInput {
+	return transactionInput{
+		UserID:        t.UserID,
+		TransactionID: t.TransactionID,
+		Amount:        t.Amount,
+		State:         t.State,
+		SourceType:    t.SourceType,
+		Currency:      t.Currency,
+		RoundID:       t.RoundID,
+		GameID:        t.GameID,
+		EndRound:      t.EndRound,
+		Bonus:         t.Bonus,
+		Wagering:      t.Wagering,
+	}
+}
+
+// replayOrConflict compares an incoming request with the stored original.
+func replayOrConflict(orig *storedTransaction, in transactionInput) (*TransactionResult, error) {
+	fingerprint := orig.Fingerprint
+	if fingerprint == "" {
+		// Rows stored before fingerprints existed
+		fingerprint = requestFingerprint(orig.input())
+	}
+
+	if fingerprint == requestFingerprint(in) {
+		return &TransactionResult{TransactionID: in.TransactionID, Balance: orig.BalanceAfter, Replayed: true}, nil
+	}
+
+	var mismatches []FieldMismatch
+	check := func(field, original, received string) {
+		if original != received {
+			mismatches = append(mismatches, FieldMismatch{Field: field, Original: original, Received: received})
+		}
+	}
+	check("userId", strconv.FormatUint(orig.UserID, 10), strconv.FormatUint(in.UserID, 10))
+	check("amount", orig.Amount.String(), in.Amount.String())
+	check("state", orig.State, in.State)
+	check("sourceType", orig.SourceType, in.SourceType)
+	check("currency", orig.Currency, in.Currency)
+	check("roundId", orig.RoundID, in.RoundID)
+	check("gameId", orig.GameID, in.GameID)
+	check("endRound", strconv.FormatBool(orig.EndRound), strconv.FormatBool(in.EndRound))
+	check("bonus", strconv.FormatBool(orig.Bonus), strconv.FormatBool(in.Bonus))
+	if orig.Bonus && in.Bonus {
+		check("wageringRequirement", orig.Wagering.String(), in.Wagering.String())
+	}
+
+	return nil, &ConflictError{TransactionID: in.TransactionID, Mismatches: mismatches}
+}
+
+// pgUniqueViolation is the SQLSTATE for unique_violation.
+const pgUniqueViolation = "23505"
+
+// mapUniqueViolation turns a unique-key violation into ErrDuplicateTransaction
+// so it surfaces as the duplicate response rather than a 500.
+func mapUniqueViolation(err error, msg string) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation {
+		return ErrDuplicateTransaction
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
@@ -0,0 +1,312 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"entain-app/internal/db"
+)
+
+// House ledger accounts, opened per currency as "<name>:<currency>". User
+// wallets are liabilities of the house: a credit increases a player's balance
+// and a debit decreases it.
+const (
+	AccountGameRevenue       = "house:game_revenue"
+	AccountPaymentClearing   = "house:payment_clearing"
+	AccountServerAdjustments = "house:server_adjustments"
+	AccountOpeningBalance    = "house:opening_balance"
+	AccountPromotions        = "house:promotions"
+	AccountTransfers         = "house:transfers" // clearing; nets to zero per transfer
+	AccountReconciliation    = "house:reconciliation"
+)
+
+type Direction string
+
+const (
+	Debit  Direction = "debit"
+	Credit Direction = "credit"
+)
+
+// Posting is one leg of a journal entry. UserID is set for wallet accounts.
+type Posting struct {
+	AccountCode string
+	UserID      uint64
+	Currency    string
+	Direction   Direction
+	Amount      Money
+}
+
+// JournalEntry groups postings whose debits and credits must balance. All
+// postings of an entry are in the same currency.
+type JournalEntry struct {
+	TransactionID string
+	Description   string
+	Postings      []Posting
+}
+
+var ErrUnbalancedEntry = errors.New("journal entry is not balanced")
+
+// WalletAccount returns the ledger account code for a user's wallet.
+func WalletAccount(userID uint64, currency string) string {
+	return fmt.Sprintf("user:%d:wallet:%s", userID, currency)
+}
+
+// HouseAccount returns the code of a house account in one currency.
+func HouseAccount(name, currency string) string {
+	return name + ":" + currency
+}
+
+// houseAccountFor picks the house counter-account for a Source-Type.
+func houseAccountFor(sourceType, currency string) string {
+	switch sourceType {
+	case "payment":
+		return HouseAccount(AccountPaymentClearing, currency)
+	case "server":
+		return HouseAccount(AccountServerAdjustments, currency)
+	case "transfer":
+		return HouseAccount(AccountTransfers, currency)
+	default:
+		return HouseAccount(AccountGameRevenue, currency)
+	}
+}
+
+// transactionEntry builds the balanced entry for a win/lose transaction.
+// A win moves money from the house to the wallet; a lose moves it back.
+// Bonus grants are funded by the promotions account.
+func transactionEntry(in transactionInput) JournalEntry {
+	houseCode := houseAccountFor(in.SourceType, in.Currency)
+	if in.Bonus {
+		houseCode = HouseAccount(AccountPromotions, in.Currency)
+	}
+	wallet := Posting{AccountCode: WalletAccount(in.UserID, in.Currency), UserID: in.UserID, Currency: in.Currency, Amount: in.Amount}
+	house := Posting{AccountCode: houseCode, Currency: in.Currency, Amount: in.Amount}
+	if in.State == "win" {
+		house.Direction, wallet.Direction = Debit, Credit
+	} else {
+		wallet.Direction, house.Direction = Debit, Credit
+	}
+	return JournalEntry{
+		TransactionID: in.TransactionID,
+		Description:   fmt.Sprintf("%s %s via %s", in.State, in.TransactionID, in.SourceType),
+		Postings:      []Posting{house, wallet},
+	}
+}
+
+// correctionEntry builds the entry that moves a wallet's postings by amount
+// (positive to credit the wallet) against the reconciliation account.
+func correctionEntry(userID uint64, currency string, amount Money, actor string) JournalEntry {
+	wallet := Posting{AccountCode: WalletAccount(userID, currency), UserID: userID, Currency: currency, Amount: amount}
+	house := Posting{AccountCode: HouseAccount(AccountReconciliation, currency), Currency: currency, Amount: amount}
+	if amount > 0 {
+		house.Direction, wallet.Direction = Debit, Credit
+	} else {
+		wallet.Direction, house.Direction = Debit, Credit
+		wallet.Amount, house.Amount = -amount, -amount
+	}
+	return JournalEntry{
+		Description: fmt.Sprintf("reconciliation correction by %s", actor),
+		Postings:    []Posting{house, wallet},
+	}
+}
+
+// Validate checks that the entry has at least two positive postings in one
+// currency and that total debits equal total credits.
+func (e JournalEntry) Validate() error {
+	if len(e.Postings) < 2 {
+		return ErrUnbalancedEntry
+	}
+	var debits, credits Money
+	var err error
+	for _, p := range e.Postings {
+		if p.Amount <= 0 || p.Currency == "" || p.Currency != e.Postings[0].Currency {
+			return ErrUnbalancedEntry
+		}
+		switch p.Direction {
+		case Debit:
+			debits, err = debits.Add(p.Amount)
+		case Credit:
+			credits, err = credits.Add(p.Amount)
+		default:
+			return ErrUnbalancedEntry
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if debits != credits {
+		return ErrUnbalancedEntry
+	}
+	return nil
+}
+
+// postJournalEntry writes a balanced entry and its postings inside tx.
+func postJournalEntry(tx *sql.Tx, e JournalEntry) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	var txID interface{}
+	if e.TransactionID != "" {
+		txID = e.TransactionID
+	}
+
+	var entryID int64
+	err := tx.QueryRow(`
+		INSERT INTO journal_entries (transaction_id, description)
+		VALUES ($1, $2) RETURNING id`, txID, e.Description).Scan(&entryID)
+	if err != nil {
+		return fmt.Errorf("failed to insert journal entry: %w", err)
+	}
+
+	for _, p := range e.Postings {
+		accountID, err := ledgerAccountID(tx, p)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO postings (entry_id, account_id, direction, amount)
+			VALUES ($1, $2, $3, $4)`, entryID, accountID, string(p.Direction), p.Amount)
+		if err != nil {
+			return fmt.Errorf("failed to insert posting: %w", err)
+		}
+	}
+	return nil
+}
+
+// ledgerAccountID resolves an account code, opening it on first use. House
+// accounts in the default currency are seeded by migrations; the others are
+// opened the first time a currency is used.
+func ledgerAccountID(tx *sql.Tx, p Posting) (int64, error) {
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM ledger_accounts WHERE code = $1`, p.AccountCode).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to look up ledger account: %w", err)
+	}
+
+	kind, userID := "house", interface{}(nil)
+	if p.UserID != 0 {
+		kind, userID = "user_wallet", p.UserID
+	}
+	_, err = tx.Exec(`
+		INSERT INTO ledger_accounts (code, kind, user_id, currency) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (code) DO NOTHING`, p.AccountCode, kind, userID, p.Currency)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open ledger account: %w", err)
+	}
+	if err := tx.QueryRow(`SELECT id FROM ledger_accounts WHERE code = $1`, p.AccountCode).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to look up ledger account: %w", err)
+	}
+	return id, nil
+}
+
+// RebuildBalance recomputes one wallet's balance from its postings and
+// returns the rebuilt value. The bonus has no postings of its own, so it is
+// kept, but never above the rebuilt balance: cash cannot go negative. A
+// bonus cut to zero drops its wagering requirement with it.
+func RebuildBalance(userID uint64, currency string) (Money, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the projection rows first so no transaction commits mid-rebuild.
+	if _, err := lockUser(tx, userID); err != nil {
+		return 0, err
+	}
+	wallet, err := lockWallet(tx, userID, currency)
+	if err != nil {
+		return 0, err
+	}
+
+	rebuilt, err := rebuildBalanceTx(tx, wallet)
+	if err != nil {
+		return 0, err
+	}
+	if rebuilt != wallet.Balance {
+		err = recordBalanceChange(tx, balanceChange{
+			Event:      EventBalanceCorrected,
+			UserID:     userID,
+			Currency:   currency,
+			Previous:   wallet.Balance,
+			New:        rebuilt,
+			Actor:      ActorLedgerRebuild,
+			SourceType: "ledger",
+			Reason:     "rebuilt from postings",
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return rebuilt, nil
+}
+
+// rebuildBalanceTx sets a locked wallet's balance to the sum of its postings,
+// keeping the bonus within it as RebuildBalance describes, and returns the
+// rebuilt value. wallet is the row as locked, before the rebuild.
+func rebuildBalanceTx(tx *sql.Tx, wallet *Wallet) (Money, error) {
+	var rebuilt Money
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(CASE p.direction WHEN 'credit' THEN p.amount ELSE -p.amount END), 0)
+		FROM postings p
+		JOIN ledger_accounts a ON a.id = p.account_id
+		WHERE a.code = $1`, WalletAccount(wallet.UserID, wallet.Currency)).Scan(&rebuilt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum postings: %w", err)
+	}
+
+	if rebuilt != wallet.Balance || wallet.Bonus > rebuilt {
+		_, err := tx.Exec(`
+			UPDATE wallets
+			SET balance = $1,
+				bonus = LEAST(bonus, GREATEST($1, 0)),
+				wagering_required = CASE WHEN LEAST(bonus, GREATEST($1, 0)) = 0 THEN 0 ELSE wagering_required END,
+				wagering_progress = CASE WHEN LEAST(bonus, GREATEST($1, 0)) = 0 THEN 0 ELSE wagering_progress END
+			WHERE user_id = $2 AND currency = $3`,
+			rebuilt, wallet.UserID, wallet.Currency)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update balance: %w", err)
+		}
+	}
+	return rebuilt, nil
+}
+
+// RebuildBalances recomputes the balance projection for every wallet.
+func RebuildBalances() error {
+	rows, err := db.DB.Query(`SELECT user_id, currency FROM wallets ORDER BY user_id, currency`)
+	if err != nil {
+		return fmt.Errorf("failed to list wallets: %w", err)
+	}
+	type key struct {
+		userID   uint64
+		currency string
+	}
+	var keys []key
+	for rows.Next() {
+		var k key
+		if err := rows.Scan(&k.userID, &k.currency); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan wallet: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list wallets: %w", err)
+	}
+
+	for _, k := range keys {
+		if _, err := RebuildBalance(k.userID, k.currency); err != nil {
+			return fmt.Errorf("failed to rebuild %s balance for user %d: %w", k.currency, k.userID, err)
+		}
+	}
+	return nil
+}
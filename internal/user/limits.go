@@ -0,0 +1,392 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"entain-app/configs"
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+var (
+	ErrLimitExceeded = errors.New("limit exceeded")
+	ErrInvalidLimit  = errors.New("invalid limit")
+	ErrLimitNotFound = errors.New("limit not found")
+)
+
+const (
+	LimitDeposit = "deposit" // payment wins
+	LimitLoss    = "loss"    // game stakes minus game wins
+	LimitWager   = "wager"   // game stakes
+
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+)
+
+var limitCfg = configs.LoadLimitConfig()
+
+// limitWindows are the rolling windows behind each period.
+var limitWindows = map[string]time.Duration{
+	PeriodDaily:   24 * time.Hour,
+	PeriodWeekly:  7 * 24 * time.Hour,
+	PeriodMonthly: 30 * 24 * time.Hour,
+}
+
+// Limit is a responsible-gambling limit over a rolling window. A raised or
+// removed limit keeps its current amount until the cooling-off period ends.
+type Limit struct {
+	Type               string     `json:"type"`
+	Period             string     `json:"period"`
+	Currency           string     `json:"currency"`
+	Amount             Money      `json:"amount"`
+	Used               Money      `json:"used"` // within the current window
+	PendingAmount      *Money     `json:"pendingAmount,omitempty"`
+	PendingRemoval     bool       `json:"pendingRemoval,omitempty"`
+	PendingEffectiveAt *time.Time `json:"pendingEffectiveAt,omitempty"`
+}
+
+// LimitExceededError is returned when a transaction would take a limit over
+// its amount.
+type LimitExceededError struct {
+	Type     string
+	Period   string
+	Currency string
+	Limit    Money
+	Used     Money
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s %s limit exceeded", e.Period, e.Type)
+}
+
+func (e *LimitExceededError) Is(target error) bool { return target == ErrLimitExceeded }
+
+// IsValidLimit reports whether limitType and period name a supported limit.
+func IsValidLimit(limitType, period string) bool {
+	_, ok := limitWindows[period]
+	return ok && (limitType == LimitDeposit || limitType == LimitLoss || limitType == LimitWager)
+}
+
+// SetLimit sets a limit. Lowering (or adding) a limit applies at once and
+// drops any pending increase; raising it only applies after the cooling-off
+// period.
+func SetLimit(userID uint64, req LimitRequest) (*Limit, error) {
+	if !IsValidLimit(req.Type, req.Period) {
+		return nil, ErrInvalidLimit
+	}
+	amount, err := ParseMoney(req.Amount)
+	if err == ErrAmountOverflow {
+		return nil, ErrAmountOverflow
+	}
+	if err != nil || amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	currency := normalizeCurrency(req.Currency)
+	if err := checkCurrencyAmount(currency, amount); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockUser(tx, userID); err != nil {
+		return nil, err
+	}
+	current, err := scanLimit(tx.QueryRow(`
+		SELECT `+limitColumns+` FROM user_limits
+		WHERE user_id = $1 AND currency = $2 AND limit_type = $3 AND period = $4`,
+		userID, currency, req.Type, req.Period))
+	if err != nil && err != ErrLimitNotFound {
+		return nil, err
+	}
+
+	if current == nil || amount <= current.Amount {
+		_, err = tx.Exec(`
+			INSERT INTO user_limits (user_id, currency, limit_type, period, amount)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (user_id, currency, limit_type, period) DO UPDATE
+			SET amount = EXCLUDED.amount, pending_amount = NULL, pending_effective_at = NULL,
+				updated_at = CURRENT_TIMESTAMP`,
+			userID, currency, req.Type, req.Period, amount)
+	} else {
+		err = scheduleLimitChange(tx, userID, currency, req.Type, req.Period, current.Amount, amount)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set limit: %w", err)
+	}
+
+	limit, err := loadLimit(tx, userID, currency, req.Type, req.Period)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id":  userID,
+		"type":     req.Type,
+		"period":   req.Period,
+		"currency": currency,
+		"amount":   amount.String(),
+		"pending":  limit.PendingEffectiveAt != nil,
+	}).Info("Set limit")
+
+	return limit, nil
+}
+
+// RemoveLimit schedules a limit's removal after the cooling-off period, as
+// removing a limit is the largest possible increase.
+func RemoveLimit(userID uint64, limitType, period, currency string) (*Limit, error) {
+	if !IsValidLimit(limitType, period) {
+		return nil, ErrInvalidLimit
+	}
+	currency = normalizeCurrency(currency)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockUser(tx, userID); err != nil {
+		return nil, err
+	}
+	current, err := loadLimit(tx, userID, currency, limitType, period)
+	if err != nil {
+		return nil, err
+	}
+	if err := scheduleLimitChange(tx, userID, currency, limitType, period, current.Amount, 0); err != nil {
+		return nil, fmt.Errorf("failed to remove limit: %w", err)
+	}
+
+	limit, err := loadLimit(tx, userID, currency, limitType, period)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id":  userID,
+		"type":     limitType,
+		"period":   period,
+		"currency": currency,
+	}).Info("Scheduled limit removal")
+
+	return limit, nil
+}
+
+// scheduleLimitChange keeps amount in force and queues next (0 removes the
+// limit) for when the cooling-off period ends. A limit whose earlier change
+// has come due is first brought up to date.
+func scheduleLimitChange(tx *sql.Tx, userID uint64, currency, limitType, period string, amount, next Money) error {
+	var pending interface{}
+	if next > 0 {
+		pending = next
+	}
+	_, err := tx.Exec(`
+		UPDATE user_limits
+		SET amount = $1, pending_amount = $2,
+			pending_effective_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second',
+			updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $4 AND currency = $5 AND limit_type = $6 AND period = $7`,
+		amount, pending, int64(limitCfg.CoolingOff/time.Second), userID, currency, limitType, period)
+	return err
+}
+
+// ListLimits returns the user's limits in force, with what each window has
+// used so far.
+func ListLimits(userID uint64) ([]Limit, error) {
+	if err := ensureUserExists(userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT `+limitColumns+` FROM user_limits
+		WHERE user_id = $1
+		ORDER BY currency, limit_type, period`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list limits: %w", err)
+	}
+	var limits []Limit
+	for rows.Next() {
+		l, err := scanLimit(rows)
+		if err == ErrLimitNotFound {
+			continue // removal has come into effect
+		} else if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		limits = append(limits, *l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list limits: %w", err)
+	}
+
+	for i := range limits {
+		l := &limits[i]
+		if l.Used, err = limitUsage(db.DB, userID, l.Currency, l.Type, l.Period, ""); err != nil {
+			return nil, err
+		}
+	}
+	return limits, nil
+}
+
+// checkLimitsTx rejects a transaction that would take any of the user's
+// limits over its amount. It runs under the user row lock taken by
+// applyTransactionTx, so concurrent transactions cannot both pass the check.
+// The transaction's own claimed row is left out of the usage.
+func checkLimitsTx(tx *sql.Tx, in transactionInput) error {
+	var types []string
+	switch {
+	case in.State == "win" && in.SourceType == "payment" && !in.Bonus:
+		types = []string{LimitDeposit}
+	case in.State == "lose" && in.SourceType == "game":
+		types = []string{LimitWager, LimitLoss}
+	default:
+		return nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT `+limitColumns+` FROM user_limits
+		WHERE user_id = $1 AND currency = $2`, in.UserID, in.Currency)
+	if err != nil {
+		return fmt.Errorf("failed to load limits: %w", err)
+	}
+	var limits []Limit
+	for rows.Next() {
+		l, err := scanLimit(rows)
+		if err == ErrLimitNotFound {
+			continue
+		} else if err != nil {
+			rows.Close()
+			return err
+		}
+		for _, t := range types {
+			if l.Type == t {
+				limits = append(limits, *l)
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load limits: %w", err)
+	}
+
+	for _, l := range limits {
+		used, err := limitUsage(tx, in.UserID, in.Currency, l.Type, l.Period, in.TransactionID)
+		if err != nil {
+			return err
+		}
+		if used+in.Amount > l.Amount {
+			return &LimitExceededError{Type: l.Type, Period: l.Period, Currency: l.Currency, Limit: l.Amount, Used: used}
+		}
+	}
+	return nil
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// heldStakes sums the game holds that can still be captured, other than the
+// one whose capture is $4, so that stakes cannot use up a limit's headroom
+// between a hold and its capture.
+const heldStakes = `(
+	SELECT COALESCE(SUM(amount), 0) FROM reservations
+	WHERE user_id = $1 AND currency = $2 AND source_type = 'game'
+	AND status = 'held' AND expires_at > CURRENT_TIMESTAMP
+	AND '` + capturePrefix + `' || reservation_id <> $4)`
+
+// limitUsage sums what counts towards a limit over its rolling window.
+// Reversed transactions and the reversals themselves are left out; held game
+// reservations count towards the wager and loss limits as if captured now.
+func limitUsage(q querier, userID uint64, currency, limitType, period, excludeID string) (Money, error) {
+	var sum string
+	switch limitType {
+	case LimitDeposit:
+		sum = `COALESCE(SUM(amount) FILTER (WHERE state = 'win' AND source_type = 'payment' AND NOT bonus_grant), 0)`
+	case LimitWager:
+		sum = `COALESCE(SUM(amount) FILTER (WHERE state = 'lose' AND source_type = 'game'), 0) + ` + heldStakes
+	case LimitLoss:
+		sum = `GREATEST(COALESCE(SUM(CASE state WHEN 'lose' THEN amount ELSE -amount END) FILTER (WHERE source_type = 'game'), 0) + ` +
+			heldStakes + `, 0)`
+	default:
+		return 0, ErrInvalidLimit
+	}
+
+	var used Money
+	err := q.QueryRow(`
+		SELECT `+sum+`
+		FROM transactions t
+		WHERE user_id = $1 AND currency = $2
+		AND created_at > CURRENT_TIMESTAMP - $3 * INTERVAL '1 second'
+		AND transaction_id <> $4
+		AND reverses_transaction_id IS NULL
+		AND NOT EXISTS (SELECT 1 FROM transactions r WHERE r.reverses_transaction_id = t.transaction_id)`,
+		userID, currency, int64(limitWindows[period]/time.Second), excludeID).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute %s usage: %w", limitType, err)
+	}
+	return used, nil
+}
+
+// loadLimit returns one limit in force with its usage.
+func loadLimit(tx *sql.Tx, userID uint64, currency, limitType, period string) (*Limit, error) {
+	l, err := scanLimit(tx.QueryRow(`
+		SELECT `+limitColumns+` FROM user_limits
+		WHERE user_id = $1 AND currency = $2 AND limit_type = $3 AND period = $4`,
+		userID, currency, limitType, period))
+	if err != nil {
+		return nil, err
+	}
+	if l.Used, err = limitUsage(tx, userID, currency, limitType, period, ""); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// limitColumns resolves pending changes that have come due, so a raised
+// limit applies as soon as its cooling-off ends without a background job.
+// The amount is NULL once a scheduled removal is in effect.
+const limitColumns = `limit_type, period, currency,
+		CASE WHEN pending_effective_at <= CURRENT_TIMESTAMP THEN pending_amount ELSE amount END,
+		CASE WHEN pending_effective_at > CURRENT_TIMESTAMP THEN pending_amount END,
+		COALESCE(pending_effective_at > CURRENT_TIMESTAMP AND pending_amount IS NULL, FALSE),
+		CASE WHEN pending_effective_at > CURRENT_TIMESTAMP THEN pending_effective_at END`
+
+func scanLimit(row rowScanner) (*Limit, error) {
+	var l Limit
+	var amount sql.NullString
+	var effectiveAt sql.NullTime
+	err := row.Scan(&l.Type, &l.Period, &l.Currency, &amount, &l.PendingAmount, &l.PendingRemoval, &effectiveAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrLimitNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch limit: %w", err)
+	}
+	if !amount.Valid {
+		return nil, ErrLimitNotFound
+	}
+	if l.Amount, err = ParseMoney(amount.String); err != nil {
+		return nil, fmt.Errorf("failed to fetch limit: %w", err)
+	}
+	l.Currency = strings.TrimSpace(l.Currency)
+	if effectiveAt.Valid {
+		t := effectiveAt.Time.UTC()
+		l.PendingEffectiveAt = &t
+	}
+	return &l, nil
+}
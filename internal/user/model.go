@@ -1,29 +1,243 @@
 package user
 
+import "time"
+
+// User is a user's balance in one currency.
 type User struct {
-	ID      uint64  `json:"userId"`
-	Balance float64 `json:"balance"`
+	ID       uint64 `json:"userId"`
+	Balance  Money  `json:"balance"`  // total, including reserved funds
+	Reserved Money  `json:"reserved"` // held by open reservations
 }
 
 type Transaction struct {
-	TransactionID string  `json:"transactionId"`
-	UserID        uint64  `json:"userId"`
-	Amount        float64 `json:"amount"`
-	State         string  `json:"state"`
-	SourceType    string  `json:"sourceType"`
+	TransactionID string    `json:"transactionId"`
+	UserID        uint64    `json:"userId"`
+	Amount        Money     `json:"amount"`
+	State         string    `json:"state"`
+	SourceType    string    `json:"sourceType"`
+	Currency      string    `json:"currency"`
+	BalanceAfter  *Money    `json:"balanceAfter,omitempty"` // nil for rows that predate tracking
+	CashAmount    *Money    `json:"cashAmount,omitempty"`   // part of amount on the cash sub-balance
+	BonusAmount   *Money    `json:"bonusAmount,omitempty"`  // part of amount on the bonus sub-balance
+	RoundID       string    `json:"roundId,omitempty"`
+	GameID        string    `json:"gameId,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+
+	// Reversal links: a reversal points at the original, and the original
+	// points back at its reversal once one exists.
+	ReversesTransactionID string `json:"reversesTransactionId,omitempty"`
+	ReversedBy            string `json:"reversedBy,omitempty"`
 }
 
 type TransactionRequest struct {
 	State         string `json:"state"`         // win or lose
 	Amount        string `json:"amount"`        // as string (e.g., "10.15")
 	TransactionID string `json:"transactionId"` // must be unique
+
+	// ISO-4217 code of the wallet to use; defaults to DEFAULT_CURRENCY.
+	Currency string `json:"currency,omitempty"`
+
+	// Optional game round: a lose stakes into the round (opening it on first
+	// use), a win settles it. EndRound settles a round with no payout.
+	RoundID  string `json:"roundId,omitempty"`
+	GameID   string `json:"gameId,omitempty"`
+	EndRound bool   `json:"endRound,omitempty"`
+}
+
+// AccountStatusRequest changes an account's lifecycle status.
+type AccountStatusRequest struct {
+	Status string `json:"status"` // active, suspended or closed
+}
+
+// BatchRequest applies many transactions, across users, in one call.
+type BatchRequest struct {
+	Mode  string      `json:"mode"` // "atomic" or "best_effort"
+	Items []BatchItem `json:"items"`
+}
+
+// BatchItem is a TransactionRequest bound to a user. SourceType defaults to
+// the request's Source-Type header.
+type BatchItem struct {
+	UserID     uint64 `json:"userId"`
+	SourceType string `json:"sourceType,omitempty"`
+	TransactionRequest
+}
+
+// BatchItemResult carries the status and body the single transaction
+// endpoint would have answered an item with.
+type BatchItemResult struct {
+	Index    int         `json:"index"`
+	Status   int         `json:"status"`
+	Replayed bool        `json:"replayed,omitempty"`
+	Body     interface{} `json:"body"`
+}
+
+type BatchResponse struct {
+	Mode      string            `json:"mode"`
+	Committed bool              `json:"committed"` // false when an atomic batch rolled back
+	Results   []BatchItemResult `json:"results"`
+}
+
+// StreamResult answers one line of an NDJSON upload with the status and body
+// the single transaction endpoint would have returned.
+type StreamResult struct {
+	Line          int         `json:"line"` // 1-based
+	TransactionID string      `json:"transactionId,omitempty"`
+	Status        int         `json:"status"`
+	Replayed      bool        `json:"replayed,omitempty"`
+	Body          interface{} `json:"body"`
+}
+
+// ReservationRequest authorizes a hold on the user's available balance.
+type ReservationRequest struct {
+	ReservationID string `json:"reservationId"`        // must be unique
+	Amount        string `json:"amount"`               // as string (e.g., "10.15")
+	TTLSeconds    int    `json:"ttlSeconds,omitempty"` // defaults to RESERVATION_DEFAULT_TTL
+	Currency      string `json:"currency,omitempty"`   // ISO-4217, defaults to DEFAULT_CURRENCY
+}
+
+// BonusRequest credits promotion funds to the bonus sub-balance.
+type BonusRequest struct {
+	TransactionID       string `json:"transactionId"`                 // must be unique
+	Amount              string `json:"amount"`                        // as string (e.g., "10.15")
+	WageringRequirement string `json:"wageringRequirement,omitempty"` // game stakes needed to convert, e.g. "350.00"
+	Currency            string `json:"currency,omitempty"`            // ISO-4217, defaults to DEFAULT_CURRENCY
+}
+
+// WalletRequest opens a wallet in another currency.
+type WalletRequest struct {
+	Currency string `json:"currency"` // ISO-4217, e.g. "USD"
+}
+
+// LimitRequest sets a deposit, loss or wager limit over a rolling period.
+type LimitRequest struct {
+	Type     string `json:"type"`               // "deposit", "loss" or "wager"
+	Period   string `json:"period"`             // "daily", "weekly" or "monthly"
+	Amount   string `json:"amount"`             // as string (e.g., "100.00")
+	Currency string `json:"currency,omitempty"` // ISO-4217, defaults to DEFAULT_CURRENCY
+}
+
+// ExclusionRequest starts a self-exclusion or a support time-out.
+type ExclusionRequest struct {
+	Type            string `json:"type"`                      // "self_exclusion" or "time_out"
+	DurationSeconds int64  `json:"durationSeconds,omitempty"` // omit for a permanent self-exclusion
+	Reason          string `json:"reason,omitempty"`
+	Actor           string `json:"actor,omitempty"` // who applied it; required for a time_out
+}
+
+// TransferRequest moves cash from one user's wallet to another's.
+type TransferRequest struct {
+	TransferID string `json:"transferId"` // must be unique
+	FromUserID uint64 `json:"fromUserId"`
+	ToUserID   uint64 `json:"toUserId"`
+	Amount     string `json:"amount"`             // as string (e.g., "10.15")
+	Currency   string `json:"currency,omitempty"` // ISO-4217, defaults to DEFAULT_CURRENCY
 }
 
 type TransactionResponse struct {
-	Message string `json:"message"`
+	Message       string `json:"message"`
+	TransactionID string `json:"transactionId,omitempty"`
+	Balance       string `json:"balance,omitempty"` // balance after the transaction
+}
+
+// AsyncTransactionResponse is returned with 202 when a transaction is queued.
+type AsyncTransactionResponse struct {
+	Message       string `json:"message"`
+	TransactionID string `json:"transactionId"`
+	Status        string `json:"status"`
+	StatusURL     string `json:"statusUrl"`
+}
+
+// ConflictResponse is returned with 409 when a transaction ID is reused with
+// a different payload.
+type ConflictResponse struct {
+	Error         string          `json:"error"`
+	TransactionID string          `json:"transactionId"`
+	Mismatches    []FieldMismatch `json:"mismatches"`
+}
+
+// LimitExceededResponse is returned with 403 when a transaction would take
+// a responsible-gambling limit over its amount.
+type LimitExceededResponse struct {
+	Error     string `json:"error"`
+	LimitType string `json:"limitType"`
+	Period    string `json:"period"`
+	Currency  string `json:"currency"`
+	Limit     string `json:"limit"`
+	Used      string `json:"used"` // within the current window, before this transaction
+}
+
+// WalletResponse is a wallet with amounts at its currency's precision.
+type WalletResponse struct {
+	Currency         string `json:"currency"`
+	Balance          string `json:"balance"`
+	AvailableBalance string `json:"availableBalance"`
+	ReservedBalance  string `json:"reservedBalance"`
+	CashBalance      string `json:"cashBalance"`  // withdrawable
+	BonusBalance     string `json:"bonusBalance"` // converts to cash once wagered
+	WageringRequired string `json:"wageringRequired"`
+	WageringProgress string `json:"wageringProgress"`
 }
 
+// BalanceResponse lists the user's wallets. The top-level fields repeat the
+// requested currency's wallet, or the default currency's when none is asked for.
 type BalanceResponse struct {
-	UserID  uint64 `json:"userId"`
-	Balance string `json:"balance"` // as string with 2 decimals
+	UserID           uint64           `json:"userId"`
+	Currency         string           `json:"currency"`
+	Balance          string           `json:"balance"` // at the currency's precision
+	AvailableBalance string           `json:"availableBalance"`
+	ReservedBalance  string           `json:"reservedBalance"`
+	CashBalance      string           `json:"cashBalance"`
+	BonusBalance     string           `json:"bonusBalance"`
+	Wallets          []WalletResponse `json:"wallets"`
+}
+
+// TransactionFilter narrows a transaction history query. Zero values mean
+// "no filter"; Cursor continues from the last item of the previous page.
+type TransactionFilter struct {
+	State      string
+	SourceType string
+	Currency   string
+	MinAmount  *Money
+	MaxAmount  *Money
+	From       *time.Time
+	To         *time.Time
+	Cursor     string
+	Limit      int
+}
+
+type TransactionHistoryResponse struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"nextCursor,omitempty"`
+}
+
+// AuditFilter narrows a balance audit query; Cursor continues from the last
+// entry of the previous page.
+type AuditFilter struct {
+	Currency string
+	Cursor   string
+	Limit    int
+}
+
+type BalanceAuditResponse struct {
+	Entries    []BalanceAuditEntry `json:"entries"`
+	NextCursor string              `json:"nextCursor,omitempty"`
+}
+
+// WebhookRequest creates or replaces a webhook subscription. UserID 0
+// subscribes to every user. Threshold, in Currency (defaults to
+// DEFAULT_CURRENCY), is needed for BalanceThresholdCrossed. Active defaults
+// to true.
+type WebhookRequest struct {
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	UserID    uint64   `json:"userId,omitempty"`
+	Threshold string   `json:"threshold,omitempty"`
+	Currency  string   `json:"currency,omitempty"`
+	Active    *bool    `json:"active,omitempty"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	NextCursor string            `json:"nextCursor,omitempty"`
 }
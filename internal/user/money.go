@@ -0,0 +1,191 @@
+package user
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact monetary amount expressed in minor units (cents).
+// It never passes through binary floating point: values are parsed from and
+// formatted to decimal strings, and exchanged with Postgres as NUMERIC text.
+type Money int64
+
+const (
+	// moneyScale is the number of decimal places held by Money.
+	moneyScale = 2
+
+	// MaxMoney is the largest value a NUMERIC(12,2) column can hold.
+	MaxMoney Money = 999_999_999_999
+)
+
+var (
+	ErrAmountOverflow = errors.New("amount exceeds maximum supported value")
+	ErrAmountFormat   = errors.New("malformed decimal amount")
+)
+
+// ParseMoney converts a decimal string such as "10.15" into Money.
+// At most two decimal places are accepted; extra trailing zeros are ignored
+// so NUMERIC values read back from Postgres parse cleanly.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrAmountFormat
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac, hasDot := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, ErrAmountFormat
+	}
+	if hasDot && frac == "" {
+		return 0, ErrAmountFormat
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, ErrAmountFormat
+	}
+
+	if len(frac) > moneyScale {
+		if strings.Trim(frac[moneyScale:], "0") != "" {
+			return 0, ErrAmountFormat
+		}
+		frac = frac[:moneyScale]
+	}
+	frac += strings.Repeat("0", moneyScale-len(frac))
+
+	whole = strings.TrimLeft(whole, "0")
+	if len(whole) > 10 {
+		return 0, ErrAmountOverflow
+	}
+
+	units, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, ErrAmountFormat
+	}
+	m := Money(units)
+	if m > MaxMoney {
+		return 0, ErrAmountOverflow
+	}
+	if neg {
+		m = -m
+	}
+	return m, nil
+}
+
+// Add returns m+o, or ErrAmountOverflow if the result does not fit NUMERIC(12,2).
+func (m Money) Add(o Money) (Money, error) {
+	sum := m + o
+	if sum > MaxMoney || sum < -MaxMoney {
+		return 0, ErrAmountOverflow
+	}
+	return sum, nil
+}
+
+// Sub returns m-o, or ErrAmountOverflow if the result does not fit NUMERIC(12,2).
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(-o)
+}
+
+// String formats the amount with exactly two decimal places, e.g. "10.15".
+func (m Money) String() string {
+	sign := ""
+	units := int64(m)
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units/100, units%100)
+}
+
+// Format formats the amount with the given number of decimal places (0 to
+// 2), e.g. "1000" for a zero-decimal currency. Digits beyond minorUnits are
+// dropped, so check FitsMinorUnits first.
+func (m Money) Format(minorUnits int) string {
+	s := m.String()
+	if minorUnits >= moneyScale {
+		return s
+	}
+	if minorUnits <= 0 {
+		return s[:len(s)-moneyScale-1]
+	}
+	return s[:len(s)-moneyScale+minorUnits]
+}
+
+// FitsMinorUnits reports whether m can be expressed with minorUnits decimal places.
+func (m Money) FitsMinorUnits(minorUnits int) bool {
+	step := int64(1)
+	for i := minorUnits; i < moneyScale; i++ {
+		step *= 10
+	}
+	return int64(m)%step == 0
+}
+
+// MarshalJSON encodes Money as a decimal string to keep clients float-free.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
+
+// UnmarshalJSON accepts a decimal string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return ErrAmountFormat
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Value implements driver.Valuer so Money is sent to Postgres as NUMERIC text.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns.
+func (m *Money) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case nil:
+		*m = 0
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money: %w", s, err)
+	}
+	*m = v
+	return nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,198 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"entain-app/configs"
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+// Domain event types written to the outbox.
+const (
+	EventTransactionProcessed = "TransactionProcessed"
+	EventTransactionReversed  = "TransactionReversed"
+	EventBalanceCorrected     = "BalanceCorrected" // ledger rebuild or reconciliation repair
+)
+
+// outboxRelayLock is the advisory lock key held by the relay publishing a
+// batch, so that relays in several server instances take turns and each
+// user's events go out in order.
+const outboxRelayLock = 7_101_021
+
+var outboxCfg = configs.LoadOutboxConfig()
+
+// Event is a domain event as published to sinks. ID increases in commit
+// order within a user; delivery is at-least-once, so consumers should
+// ignore IDs they have already seen.
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	UserID    uint64          `json:"userId"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// BalanceEvent is the payload of every event written for a balance change.
+type BalanceEvent struct {
+	TransactionID   string `json:"transactionId,omitempty"`
+	Currency        string `json:"currency"`
+	PreviousBalance Money  `json:"previousBalance"`
+	Balance         Money  `json:"balance"`
+	Change          Money  `json:"change"`
+	Actor           string `json:"actor"`
+	SourceType      string `json:"sourceType"`
+	Reason          string `json:"reason"`
+}
+
+// enqueueEvent writes an event to the outbox inside tx, so that it is
+// published if and only if the change it describes commits. Balance streams
+// on every server instance are notified at the same commit.
+func enqueueEvent(tx *sql.Tx, eventType string, userID uint64, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	_, err = tx.Exec(`INSERT INTO outbox_events (event_type, user_id, payload) VALUES ($1, $2, $3)`,
+		eventType, userID, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to write outbox event: %w", err)
+	}
+	_, err = tx.Exec(`SELECT pg_notify($1, $2)`, balanceEventsChannel, strconv.FormatUint(userID, 10))
+	if err != nil {
+		return fmt.Errorf("failed to notify balance streams: %w", err)
+	}
+	return nil
+}
+
+// ConfiguredSink returns the sinks the server publishes to: webhooks, and
+// the sink selected by OUTBOX_SINK unless it is "none".
+func ConfiguredSink() (Sink, error) {
+	sinks := MultiSink{}
+	if outboxCfg.Sink == configs.SinkFile {
+		file, err := NewFileSink(outboxCfg.File)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, file)
+	}
+	return append(sinks, WebhookSink{}), nil
+}
+
+// StartOutboxRelay publishes outbox events to sink until ctx is cancelled.
+func StartOutboxRelay(ctx context.Context, sink Sink) {
+	ticker := time.NewTicker(outboxCfg.PollInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			// Drain full batches, then wait for the next poll
+			for ctx.Err() == nil {
+				fetched, published, err := relayOutbox(ctx, sink)
+				if err != nil {
+					utils.Logger.WithError(err).Error("Outbox relay failed")
+					break
+				}
+				if fetched < outboxCfg.BatchSize || published == 0 {
+					break
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// relayOutbox publishes the oldest unpublished events in ID order and marks
+// the ones the sink accepted. Once an event of a user fails, that user's
+// later events wait for the next attempt, which keeps them in order; other
+// users carry on. An event is only marked after the sink accepted it, so a
+// crash in between publishes it again.
+func relayOutbox(ctx context.Context, sink Sink) (fetched, published int, err error) {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, outboxRelayLock).Scan(&locked); err != nil {
+		return 0, 0, fmt.Errorf("failed to take outbox lock: %w", err)
+	}
+	if !locked {
+		return 0, 0, nil // another relay is publishing
+	}
+
+	rows, err := tx.Query(`
+		SELECT `+eventColumns+` FROM outbox_events
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1`, outboxCfg.BatchSize)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to fetch outbox events: %w", err)
+	}
+	var events []Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		events = append(events, *e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to fetch outbox events: %w", err)
+	}
+
+	blocked := make(map[uint64]bool)
+	var ids []int64
+	for _, e := range events {
+		if blocked[e.UserID] {
+			continue
+		}
+		if err := sink.Publish(ctx, e); err != nil {
+			blocked[e.UserID] = true
+			utils.Logger.WithError(err).WithFields(map[string]interface{}{
+				"event_id": e.ID,
+				"user_id":  e.UserID,
+			}).Warn("Failed to publish event")
+			continue
+		}
+		ids = append(ids, e.ID)
+	}
+
+	if len(ids) > 0 {
+		_, err := tx.Exec(`UPDATE outbox_events SET published_at = CURRENT_TIMESTAMP WHERE id = ANY($1)`, pq.Array(ids))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to mark events published: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(events), len(ids), nil
+}
+
+const eventColumns = `id, event_type, user_id, payload, created_at`
+
+func scanEvent(row rowScanner) (*Event, error) {
+	var e Event
+	var payload []byte
+	if err := row.Scan(&e.ID, &e.Type, &e.UserID, &payload, &e.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+	}
+	e.Payload = payload
+	e.CreatedAt = e.CreatedAt.UTC()
+	return &e, nil
+}
@@ -0,0 +1,318 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"entain-app/configs"
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+var (
+	ErrQueuedNotFound = errors.New("queued transaction not found")
+	ErrQueueConflict  = errors.New("transaction ID already queued with a different payload")
+)
+
+const (
+	QueueQueued     = "queued"
+	QueueProcessing = "processing"
+	QueueDone       = "done"   // applied, or replayed an earlier result
+	QueueFailed     = "failed" // rejected; Response holds the error
+
+	// maxQueueAttempts bounds retries of items that failed with a server error.
+	maxQueueAttempts = 5
+)
+
+var asyncCfg = configs.LoadAsyncConfig()
+
+// callbackClient posts callbacks without following redirects, so a callback
+// cannot be bounced to a host outside ASYNC_CALLBACK_HOSTS.
+var callbackClient = &http.Client{
+	Timeout: asyncCfg.CallbackTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// queueWake lets EnqueueTransaction start an idle worker in this process
+// without waiting for the next poll.
+var queueWake = make(chan struct{}, 1)
+
+// QueuedTransaction is a transaction accepted for asynchronous processing.
+// Once finished, HTTPStatus and Response are what the synchronous endpoint
+// would have answered.
+type QueuedTransaction struct {
+	TransactionID string          `json:"transactionId"`
+	UserID        uint64          `json:"userId"`
+	Status        string          `json:"status"`
+	HTTPStatus    int             `json:"httpStatus,omitempty"`
+	Response      json.RawMessage `json:"response,omitempty"`
+	Attempts      int             `json:"attempts"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	UpdatedAt     time.Time       `json:"updatedAt"`
+	Replayed      bool            `json:"-"`
+
+	id          int64
+	request     TransactionRequest
+	sourceType  string
+	callbackURL string
+}
+
+// EnqueueTransaction validates a transaction and stores it for the workers.
+// Enqueueing the same transaction ID again returns the queued item, or
+// ErrQueueConflict if the payload differs. If callbackURL is set, the
+// finished item is POSTed to it; callers check it with IsAllowedCallbackURL.
+func EnqueueTransaction(userID uint64, req TransactionRequest, sourceType, callbackURL string) (*QueuedTransaction, error) {
+	in, err := newTransactionInput(userID, req, sourceType)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureUserExists(userID); err != nil {
+		return nil, err
+	}
+	request, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	fingerprint := requestFingerprint(in)
+	q, err := scanQueuedTransaction(db.DB.QueryRow(`
+		INSERT INTO transaction_queue (transaction_id, user_id, source_type, request, request_fingerprint, callback_url)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (transaction_id) DO NOTHING
+		RETURNING `+queueColumns,
+		in.TransactionID, userID, in.SourceType, string(request), fingerprint, nullString(callbackURL)))
+	if err == ErrQueuedNotFound {
+		// Already queued: replay it if the payload matches
+		var stored string
+		err := db.DB.QueryRow(`SELECT request_fingerprint FROM transaction_queue WHERE transaction_id = $1`,
+			in.TransactionID).Scan(&stored)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch queued transaction: %w", err)
+		}
+		if stored != fingerprint {
+			return nil, ErrQueueConflict
+		}
+		q, err := GetQueuedTransaction(userID, in.TransactionID)
+		if err != nil {
+			return nil, err
+		}
+		q.Replayed = true
+		return q, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	select {
+	case queueWake <- struct{}{}:
+	default:
+	}
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id":        userID,
+		"transaction_id": in.TransactionID,
+		"source_type":    in.SourceType,
+	}).Info("Queued transaction")
+
+	return q, nil
+}
+
+// GetQueuedTransaction returns the status of a queued transaction.
+func GetQueuedTransaction(userID uint64, transactionID string) (*QueuedTransaction, error) {
+	return scanQueuedTransaction(db.DB.QueryRow(`
+		SELECT `+queueColumns+` FROM transaction_queue
+		WHERE transaction_id = $1 AND user_id = $2`, transactionID, userID))
+}
+
+// StartTransactionWorkers starts the pool that applies queued transactions.
+// Each user's transactions are applied one at a time in the order they were
+// queued, by whichever worker (in any server instance) claims the oldest
+// unfinished one.
+func StartTransactionWorkers(ctx context.Context) {
+	for i := 0; i < asyncCfg.Workers; i++ {
+		go runTransactionWorker(ctx)
+	}
+}
+
+func runTransactionWorker(ctx context.Context) {
+	ticker := time.NewTicker(asyncCfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		// Drain the queue, then wait for a poll or a wake-up
+		for ctx.Err() == nil {
+			q, err := claimQueuedTransaction()
+			if err != nil {
+				utils.Logger.WithError(err).Error("Failed to claim queued transaction")
+				break
+			}
+			if q == nil || !processQueuedTransaction(ctx, q) {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-queueWake:
+		}
+	}
+}
+
+// claimQueuedTransaction marks the next claimable item as processing and
+// returns it, or nil if there is none. Only the oldest unfinished item of a
+// user can be claimed, and only while no other worker holds it, which keeps
+// each user's items in FIFO order. An item whose worker did not finish it
+// within the lease is claimed again; applying it twice is safe as the
+// transaction ID makes the second attempt a replay.
+func claimQueuedTransaction() (*QueuedTransaction, error) {
+	q, err := scanQueuedTransaction(db.DB.QueryRow(`
+		UPDATE transaction_queue
+		SET status = 'processing', attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT q.id FROM transaction_queue q
+			WHERE q.status IN ('queued', 'processing')
+			AND (q.status = 'queued' OR q.updated_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second')
+			AND q.id = (
+				SELECT MIN(f.id) FROM transaction_queue f
+				WHERE f.user_id = q.user_id AND f.status IN ('queued', 'processing')
+			)
+			ORDER BY q.id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+queueColumns, asyncCfg.Lease.Seconds()))
+	if err == ErrQueuedNotFound {
+		return nil, nil
+	}
+	return q, err
+}
+
+// processQueuedTransaction applies a claimed item and stores its outcome.
+// Server errors are retried up to maxQueueAttempts, after the next poll;
+// every other outcome, including a rejection, is final. It reports false
+// when the item was put back for a retry.
+func processQueuedTransaction(ctx context.Context, q *QueuedTransaction) bool {
+	in, err := newTransactionInput(q.UserID, q.request, q.sourceType)
+	var result *TransactionResult
+	if err == nil {
+		in.Actor = ActorAsyncWorker
+		result, err = processTransaction(in)
+	}
+
+	status, body := http.StatusOK, interface{}(nil)
+	if err == nil {
+		body = newTransactionResponse(result)
+	} else {
+		status, body = transactionError(err)
+	}
+	if status == http.StatusInternalServerError && q.Attempts < maxQueueAttempts {
+		utils.Logger.WithError(err).WithField("transaction_id", q.TransactionID).Warn("Retrying queued transaction")
+		_, err := db.DB.Exec(`
+			UPDATE transaction_queue SET status = 'queued', updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND status = 'processing'`, q.id)
+		if err != nil {
+			utils.Logger.WithError(err).Error("Failed to requeue transaction")
+		}
+		return false
+	}
+
+	response, _ := json.Marshal(body)
+	q.Status, q.HTTPStatus, q.Response = QueueDone, status, response
+	if status != http.StatusOK {
+		q.Status = QueueFailed
+	}
+	err = db.DB.QueryRow(`
+		UPDATE transaction_queue
+		SET status = $1, http_status = $2, response = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+		RETURNING updated_at`, q.Status, status, string(response), q.id).Scan(&q.UpdatedAt)
+	if err != nil {
+		utils.Logger.WithError(err).WithField("transaction_id", q.TransactionID).Error("Failed to store queued outcome")
+		return false
+	}
+	q.UpdatedAt = q.UpdatedAt.UTC()
+
+	if q.callbackURL != "" {
+		notifyCallback(ctx, q)
+	}
+	return true
+}
+
+// IsAllowedCallbackURL reports whether raw is an https URL on one of the
+// ASYNC_CALLBACK_HOSTS. With no hosts configured, no callback is allowed.
+func IsAllowedCallbackURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return false
+	}
+	for _, host := range asyncCfg.CallbackHosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyCallback POSTs a finished item to its callback URL once. Clients
+// that miss it can still poll for the status. The URL is checked again, as
+// the allowed hosts may have changed since the item was queued.
+func notifyCallback(ctx context.Context, q *QueuedTransaction) {
+	if !IsAllowedCallbackURL(q.callbackURL) {
+		utils.Logger.WithField("transaction_id", q.TransactionID).Warn("Callback URL no longer allowed")
+		return
+	}
+	payload, err := json.Marshal(q)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.callbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := callbackClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("callback returned %s", resp.Status)
+		}
+	}
+	if err != nil {
+		utils.Logger.WithError(err).WithField("transaction_id", q.TransactionID).Warn("Callback failed")
+	}
+}
+
+const queueColumns = `id, transaction_id, user_id, source_type, request, COALESCE(callback_url, ''), status,
+		COALESCE(http_status, 0), response, attempts, created_at, updated_at`
+
+func scanQueuedTransaction(row rowScanner) (*QueuedTransaction, error) {
+	var q QueuedTransaction
+	var request, response []byte
+	err := row.Scan(&q.id, &q.TransactionID, &q.UserID, &q.sourceType, &request, &q.callbackURL, &q.Status,
+		&q.HTTPStatus, &response, &q.Attempts, &q.CreatedAt, &q.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrQueuedNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch queued transaction: %w", err)
+	}
+	if err := json.Unmarshal(request, &q.request); err != nil {
+		return nil, fmt.Errorf("failed to decode queued request: %w", err)
+	}
+	if len(response) > 0 {
+		q.Response = response
+	}
+	q.CreatedAt = q.CreatedAt.UTC()
+	q.UpdatedAt = q.UpdatedAt.UTC()
+	return &q, nil
+}
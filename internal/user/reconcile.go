@@ -0,0 +1,258 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"entain-app/configs"
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+var reconcileCfg = configs.LoadReconcileConfig()
+
+var (
+	driftWallets = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "wallet_balance_drift_wallets",
+		Help: "Wallets whose balance differed from the transaction log at the last reconciliation.",
+	})
+	driftAmount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wallet_balance_drift_amount",
+		Help: "Sum of absolute balance drift per currency at the last reconciliation, in major units.",
+	}, []string{"currency"})
+	reconcileRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reconciliation_runs_total",
+		Help: "Reconciliation runs by result: ok, drift or error.",
+	}, []string{"result"})
+	reconcileCorrections = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "reconciliation_corrections_total",
+		Help: "Wallet balances corrected by reconciliation.",
+	})
+	reconcileLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "reconciliation_last_run_timestamp_seconds",
+		Help: "Unix time at which the last reconciliation finished.",
+	})
+)
+
+// BalanceDrift is a wallet whose balance does not match its transaction log.
+// Drift is Balance minus Expected. Ledger is the sum of the wallet's postings,
+// reported to tell a stale projection (Ledger equals Expected) apart from a
+// ledger that disagrees with the transactions too.
+type BalanceDrift struct {
+	UserID   uint64 `json:"userId"`
+	Currency string `json:"currency"`
+	Balance  Money  `json:"balance"`
+	Expected Money  `json:"expected"`
+	Ledger   Money  `json:"ledger"`
+	Drift    Money  `json:"drift"`
+	Repaired bool   `json:"repaired"`
+}
+
+// ReconciliationReport is the outcome of one reconciliation run.
+type ReconciliationReport struct {
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt"`
+	Wallets    int            `json:"wallets"`
+	Repair     bool           `json:"repair"`
+	Drifts     []BalanceDrift `json:"drifts"`
+}
+
+// Reconcile recomputes every wallet's balance from the transaction log, wins
+// minus losses (reversals included), plus any opening balance carried over
+// from before the ledger. Wallets that disagree are reported and, with
+// repair, brought to the recomputed balance through the ledger; each
+// correction is recorded in balance_corrections with the actor that made it.
+func Reconcile(repair bool, actor string) (*ReconciliationReport, error) {
+	report := &ReconciliationReport{StartedAt: time.Now().UTC(), Repair: repair, Drifts: []BalanceDrift{}}
+
+	// One statement, so every wallet is compared against a consistent snapshot
+	rows, err := db.DB.Query(`SELECT ` + reconcileColumns + ` FROM wallets w ORDER BY w.user_id, w.currency`)
+	if err != nil {
+		reconcileRuns.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("failed to recompute balances: %w", err)
+	}
+	for rows.Next() {
+		var d BalanceDrift
+		if err := rows.Scan(&d.UserID, &d.Currency, &d.Balance, &d.Expected, &d.Ledger); err != nil {
+			rows.Close()
+			reconcileRuns.WithLabelValues("error").Inc()
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		report.Wallets++
+		if d.Balance != d.Expected {
+			d.Drift = d.Balance - d.Expected
+			report.Drifts = append(report.Drifts, d)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		reconcileRuns.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("failed to recompute balances: %w", err)
+	}
+
+	for i := range report.Drifts {
+		d := &report.Drifts[i]
+		utils.Logger.WithFields(map[string]interface{}{
+			"user_id":  d.UserID,
+			"currency": d.Currency,
+			"balance":  d.Balance.String(),
+			"expected": d.Expected.String(),
+			"ledger":   d.Ledger.String(),
+			"drift":    d.Drift.String(),
+		}).Warn("Balance drift detected")
+
+		if repair {
+			if err := repairBalance(d, actor); err != nil {
+				reconcileRuns.WithLabelValues("error").Inc()
+				return nil, fmt.Errorf("failed to repair %s balance for user %d: %w", d.Currency, d.UserID, err)
+			}
+		}
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	recordReconcileMetrics(report)
+	return report, nil
+}
+
+// repairBalance brings a drifting wallet to its recomputed balance. Where the
+// postings disagree with the transaction log too, the difference is posted
+// against the reconciliation account; the balance is then rebuilt from the
+// postings, so that a later RebuildBalance keeps the repair. Everything is
+// read again under the user lock, as balances may have moved since the scan;
+// a drift that has gone away, or changed, is left alone.
+func repairBalance(d *BalanceDrift, actor string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := lockUser(tx, d.UserID); err != nil {
+		return err
+	}
+	wallet, err := lockWallet(tx, d.UserID, d.Currency)
+	if err != nil {
+		return err
+	}
+	var current BalanceDrift
+	err = tx.QueryRow(`SELECT `+reconcileColumns+` FROM wallets w WHERE w.user_id = $1 AND w.currency = $2`,
+		d.UserID, d.Currency).Scan(&current.UserID, &current.Currency, &current.Balance, &current.Expected, &current.Ledger)
+	if err != nil {
+		return fmt.Errorf("failed to recompute balance: %w", err)
+	}
+	if current.Balance-current.Expected != d.Drift {
+		return nil
+	}
+
+	if correction := current.Expected - current.Ledger; correction != 0 {
+		if err := postJournalEntry(tx, correctionEntry(d.UserID, d.Currency, correction, actor)); err != nil {
+			return err
+		}
+	}
+	repaired, err := rebuildBalanceTx(tx, wallet)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO balance_corrections (user_id, currency, previous_balance, corrected_balance, ledger_balance, actor)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		d.UserID, d.Currency, current.Balance, repaired, current.Ledger, actor)
+	if err != nil {
+		return fmt.Errorf("failed to record correction: %w", err)
+	}
+	err = recordBalanceChange(tx, balanceChange{
+		Event:      EventBalanceCorrected,
+		UserID:     d.UserID,
+		Currency:   d.Currency,
+		Previous:   current.Balance,
+		New:        repaired,
+		Actor:      actor,
+		SourceType: "reconciliation",
+		Reason:     "corrected drift from the transaction log",
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	d.Repaired = true
+	reconcileCorrections.Inc()
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id":  d.UserID,
+		"currency": d.Currency,
+		"previous": current.Balance.String(),
+		"balance":  repaired.String(),
+		"actor":    actor,
+	}).Info("Corrected balance drift")
+	return nil
+}
+
+func recordReconcileMetrics(report *ReconciliationReport) {
+	driftWallets.Set(float64(len(report.Drifts)))
+	driftAmount.Reset()
+	for _, d := range report.Drifts {
+		drift := d.Drift
+		if drift < 0 {
+			drift = -drift
+		}
+		driftAmount.WithLabelValues(d.Currency).Add(float64(drift) / 100)
+	}
+	result := "ok"
+	if len(report.Drifts) > 0 {
+		result = "drift"
+	}
+	reconcileRuns.WithLabelValues(result).Inc()
+	reconcileLastRun.Set(float64(report.FinishedAt.Unix()))
+}
+
+// StartReconciler reconciles balances on an interval until ctx is cancelled,
+// repairing drift if configured to.
+func StartReconciler(ctx context.Context) {
+	ticker := time.NewTicker(reconcileCfg.Interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := Reconcile(reconcileCfg.Repair, "reconcile-job")
+				if err != nil {
+					utils.Logger.WithError(err).Error("Reconciliation failed")
+				} else {
+					utils.Logger.WithFields(map[string]interface{}{
+						"wallets": report.Wallets,
+						"drifts":  len(report.Drifts),
+					}).Info("Reconciled balances")
+				}
+			}
+		}
+	}()
+}
+
+// reconcileColumns selects a wallet's balance, the balance recomputed from
+// its transactions and opening entries, and the sum of its postings. Opening
+// entries are told apart from reconciliation corrections, which have no
+// transaction either, by their opening balance leg.
+const reconcileColumns = `w.user_id, w.currency, w.balance,
+		(SELECT COALESCE(SUM(CASE t.state WHEN 'win' THEN t.amount ELSE -t.amount END), 0)
+			FROM transactions t WHERE t.user_id = w.user_id AND t.currency = w.currency)
+		+ (SELECT COALESCE(SUM(CASE p.direction WHEN 'credit' THEN p.amount ELSE -p.amount END), 0)
+			FROM postings p
+			JOIN ledger_accounts a ON a.id = p.account_id
+			JOIN journal_entries e ON e.id = p.entry_id
+			WHERE a.code = 'user:' || w.user_id || ':wallet:' || w.currency AND e.transaction_id IS NULL
+			AND EXISTS (
+				SELECT 1 FROM postings o
+				JOIN ledger_accounts oa ON oa.id = o.account_id
+				WHERE o.entry_id = e.id AND oa.code = '` + AccountOpeningBalance + `:' || w.currency)),
+		(SELECT COALESCE(SUM(CASE p.direction WHEN 'credit' THEN p.amount ELSE -p.amount END), 0)
+			FROM postings p
+			JOIN ledger_accounts a ON a.id = p.account_id
+			WHERE a.code = 'user:' || w.user_id || ':wallet:' || w.currency)`
@@ -0,0 +1,442 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"entain-app/configs"
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+var (
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrReservationNotHeld  = errors.New("reservation is no longer held")
+	ErrReservationExpired  = errors.New("reservation has expired")
+	ErrReservationConflict = errors.New("reservation ID already used with a different payload")
+	ErrInvalidTTL          = errors.New("invalid reservation TTL")
+)
+
+const (
+	ReservationHeld     = "held"
+	ReservationCaptured = "captured"
+	ReservationReleased = "released"
+	ReservationExpired  = "expired"
+)
+
+var reservationCfg = configs.LoadReservationConfig()
+
+// Reservation is a hold on part of a wallet's balance. While held it reduces
+// the available balance but not the total balance.
+type Reservation struct {
+	ReservationID string    `json:"reservationId"`
+	UserID        uint64    `json:"userId"`
+	Amount        Money     `json:"amount"`
+	Currency      string    `json:"currency"`
+	Status        string    `json:"status"`
+	SourceType    string    `json:"sourceType"`
+	TransactionID string    `json:"transactionId,omitempty"` // set once captured
+	ExpiresAt     time.Time `json:"expiresAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Replayed      bool      `json:"-"`
+}
+
+// capturePrefix starts the ID of every capture debit.
+const capturePrefix = "capture:"
+
+// CaptureID is the transaction ID of the debit written when a reservation
+// is captured.
+func CaptureID(reservationID string) string {
+	return capturePrefix + reservationID
+}
+
+// AuthorizeReservation holds amount of the user's available balance until it
+// is captured, released or expires. Reusing a reservation ID with the same
+// payload returns the existing reservation.
+func AuthorizeReservation(userID uint64, req ReservationRequest, sourceType string) (*Reservation, error) {
+	sourceType = strings.ToLower(sourceType)
+
+	amount, err := ParseMoney(req.Amount)
+	if err == ErrAmountOverflow {
+		return nil, ErrAmountOverflow
+	}
+	if err != nil || amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	currency := normalizeCurrency(req.Currency)
+	if err := checkCurrencyAmount(currency, amount); err != nil {
+		return nil, err
+	}
+
+	ttl := reservationCfg.DefaultTTL
+	if req.TTLSeconds < 0 {
+		return nil, ErrInvalidTTL
+	} else if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > reservationCfg.MaxTTL {
+		return nil, ErrInvalidTTL
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	status, err := lockUser(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusActive {
+		return nil, ErrAccountNotActive
+	}
+	// Game holds are stakes, which an exclusion rules out
+	if sourceType == "game" {
+		if excluded, err := isExcludedTx(tx, userID); err != nil {
+			return nil, err
+		} else if excluded {
+			return nil, ErrExcluded
+		}
+	}
+	wallet, err := lockWallet(tx, userID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claim the reservation ID first, as ProcessTransaction does
+	res, err := tx.Exec(`
+		INSERT INTO reservations (reservation_id, user_id, amount, currency, source_type, expires_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP + $6 * INTERVAL '1 second')
+		ON CONFLICT (reservation_id) DO NOTHING`,
+		req.ReservationID, userID, amount, currency, sourceType, int64(ttl/time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert reservation: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to insert reservation: %w", err)
+	} else if n == 0 {
+		tx.Rollback()
+		existing, err := GetReservation(userID, req.ReservationID)
+		if err == ErrReservationNotFound {
+			return nil, ErrReservationConflict
+		} else if err != nil {
+			return nil, err
+		}
+		if existing.Amount != amount || existing.Currency != currency || existing.SourceType != sourceType {
+			return nil, ErrReservationConflict
+		}
+		existing.Replayed = true
+		return existing, nil
+	}
+
+	if wallet.Available() < amount {
+		return nil, ErrInsufficientBalance
+	}
+	// Withdrawals can only hold cash, as they can only spend it, and the cash
+	// they hold is kept apart so that nothing else spends it first
+	var heldCash Money
+	if sourceType == "payment" {
+		if wallet.AvailableCash() < amount {
+			return nil, ErrInsufficientCash
+		}
+		heldCash = amount
+	}
+	// A game hold is a stake, so it must fit the wager and loss limits now
+	// rather than only when it is captured
+	err = checkLimitsTx(tx, transactionInput{
+		UserID:        userID,
+		TransactionID: CaptureID(req.ReservationID),
+		Amount:        amount,
+		State:         "lose",
+		SourceType:    sourceType,
+		Currency:      currency,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE wallets SET reserved = reserved + $1, reserved_cash = reserved_cash + $2
+		WHERE user_id = $3 AND currency = $4`,
+		amount, heldCash, userID, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update reserved balance: %w", err)
+	}
+
+	r, err := scanReservation(tx.QueryRow(`SELECT `+reservationColumns+` FROM reservations WHERE reservation_id = $1`, req.ReservationID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id":        userID,
+		"reservation_id": r.ReservationID,
+		"amount":         amount.String(),
+		"currency":       currency,
+		"expires_at":     r.ExpiresAt,
+	}).Info("Authorized reservation")
+
+	return r, nil
+}
+
+// CaptureReservation turns a held reservation into a final debit. The hold
+// is dropped and a lose transaction CaptureID(id) is applied in the same DB
+// transaction. Capturing an already captured reservation replays the result.
+func CaptureReservation(userID uint64, reservationID string) (*TransactionResult, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	r, expired, err := lockReservation(tx, userID, reservationID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case r.Status == ReservationCaptured:
+		tx.Rollback()
+		orig, err := findStoredTransaction(r.TransactionID)
+		if err != nil {
+			return nil, err
+		}
+		result := &TransactionResult{TransactionID: r.TransactionID, Replayed: true}
+		if orig != nil {
+			result.Balance = orig.BalanceAfter
+		}
+		return result, nil
+	case r.Status != ReservationHeld:
+		return nil, ErrReservationNotHeld
+	case expired:
+		return nil, ErrReservationExpired
+	}
+
+	if err := releaseHold(tx, r); err != nil {
+		return nil, err
+	}
+
+	result, err := applyTransactionTx(tx, transactionInput{
+		UserID:        userID,
+		TransactionID: CaptureID(reservationID),
+		Amount:        r.Amount,
+		State:         "lose",
+		SourceType:    r.SourceType,
+		Currency:      r.Currency,
+		Capture:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE reservations SET status = $1, transaction_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE reservation_id = $3`, ReservationCaptured, result.TransactionID, reservationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update reservation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, mapUniqueViolation(err, "failed to commit transaction")
+	}
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id":        userID,
+		"reservation_id": reservationID,
+		"transaction_id": result.TransactionID,
+		"amount":         r.Amount.String(),
+	}).Info("Captured reservation")
+
+	return result, nil
+}
+
+// ReleaseReservation returns held funds to the available balance. Releasing
+// an already released reservation returns it unchanged.
+func ReleaseReservation(userID uint64, reservationID string) (*Reservation, error) {
+	return endReservation(userID, reservationID, ReservationReleased)
+}
+
+// endReservation drops a hold, marking the reservation released or expired.
+func endReservation(userID uint64, reservationID, status string) (*Reservation, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	r, _, err := lockReservation(tx, userID, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status == status {
+		r.Replayed = true
+		return r, nil
+	}
+	if r.Status != ReservationHeld {
+		return nil, ErrReservationNotHeld
+	}
+
+	if err := releaseHold(tx, r); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		UPDATE reservations SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE reservation_id = $2`, status, reservationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update reservation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	r.Status = status
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id":        userID,
+		"reservation_id": reservationID,
+		"amount":         r.Amount.String(),
+		"status":         status,
+	}).Info("Ended reservation")
+
+	return r, nil
+}
+
+// releaseHold takes a reservation's amount off its wallet's reserved funds,
+// and off its held cash for withdrawals.
+func releaseHold(tx *sql.Tx, r *Reservation) error {
+	var heldCash Money
+	if r.SourceType == "payment" {
+		heldCash = r.Amount
+	}
+	_, err := tx.Exec(`
+		UPDATE wallets SET reserved = reserved - $1, reserved_cash = reserved_cash - $2
+		WHERE user_id = $3 AND currency = $4`,
+		r.Amount, heldCash, r.UserID, r.Currency)
+	if err != nil {
+		return fmt.Errorf("failed to update reserved balance: %w", err)
+	}
+	return nil
+}
+
+// lockReservation locks the user row, then the reservation row, matching the
+// lock order of ProcessTransaction. It also reports whether the TTL has passed.
+func lockReservation(tx *sql.Tx, userID uint64, reservationID string) (*Reservation, bool, error) {
+	if _, err := lockUser(tx, userID); err != nil {
+		return nil, false, err
+	}
+
+	r, err := scanReservation(tx.QueryRow(`
+		SELECT `+reservationColumns+`
+		FROM reservations WHERE reservation_id = $1 AND user_id = $2 FOR UPDATE`, reservationID, userID))
+	if err != nil {
+		return nil, false, err
+	}
+
+	var expired bool
+	err = tx.QueryRow(`SELECT expires_at <= CURRENT_TIMESTAMP FROM reservations WHERE reservation_id = $1`, reservationID).
+		Scan(&expired)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to check reservation expiry: %w", err)
+	}
+	return r, expired, nil
+}
+
+// GetReservation returns a reservation owned by the user.
+func GetReservation(userID uint64, reservationID string) (*Reservation, error) {
+	return scanReservation(db.DB.QueryRow(`
+		SELECT `+reservationColumns+`
+		FROM reservations WHERE reservation_id = $1 AND user_id = $2`, reservationID, userID))
+}
+
+const reservationColumns = `reservation_id, user_id, amount, currency, status, source_type, transaction_id, expires_at, created_at`
+
+func scanReservation(row rowScanner) (*Reservation, error) {
+	var r Reservation
+	var txID sql.NullString
+	err := row.Scan(&r.ReservationID, &r.UserID, &r.Amount, &r.Currency, &r.Status, &r.SourceType, &txID, &r.ExpiresAt, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrReservationNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch reservation: %w", err)
+	}
+	r.TransactionID = txID.String
+	r.ExpiresAt = r.ExpiresAt.UTC()
+	r.CreatedAt = r.CreatedAt.UTC()
+	return &r, nil
+}
+
+// ExpireReservations releases every held reservation whose TTL has passed
+// and returns how many were expired.
+func ExpireReservations() (int, error) {
+	rows, err := db.DB.Query(`
+		SELECT reservation_id, user_id FROM reservations
+		WHERE status = 'held' AND expires_at <= CURRENT_TIMESTAMP
+		ORDER BY expires_at
+		LIMIT 500`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired reservations: %w", err)
+	}
+
+	type due struct {
+		id     string
+		userID uint64
+	}
+	var pending []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.userID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan reservation: %w", err)
+		}
+		pending = append(pending, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list expired reservations: %w", err)
+	}
+
+	expired := 0
+	for _, d := range pending {
+		_, err := endReservation(d.userID, d.id, ReservationExpired)
+		switch err {
+		case nil:
+			expired++
+		case ErrReservationNotHeld:
+			// Captured or released since it was listed
+		default:
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// StartReservationSweeper expires stale reservations on an interval until
+// ctx is cancelled.
+func StartReservationSweeper(ctx context.Context) {
+	ticker := time.NewTicker(reservationCfg.SweepInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := ExpireReservations()
+				if err != nil {
+					utils.Logger.WithError(err).Error("Reservation sweep failed")
+				} else if n > 0 {
+					utils.Logger.WithField("expired", n).Info("Expired reservations")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,173 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+var (
+	ErrAlreadyReversed = errors.New("transaction already reversed")
+	ErrNotReversible   = errors.New("reversal transactions cannot be reversed")
+)
+
+// reversalPrefix starts the ID of every compensating entry.
+const reversalPrefix = "reversal:"
+
+// ReversalID is the transaction ID given to the compensating entry of a
+// reversed transaction.
+func ReversalID(transactionID string) string {
+	return reversalPrefix + transactionID
+}
+
+// oppositeState returns the state that undoes the given one.
+func oppositeState(state string) string {
+	if state == "win" {
+		return "lose"
+	}
+	return "win"
+}
+
+// withoutBonus drops the bonus flag, which on a reversal only selects the
+// ledger counterpart and is not part of the stored request.
+func withoutBonus(in transactionInput) transactionInput {
+	in.Bonus = false
+	return in
+}
+
+// ReverseTransaction undoes a stored transaction by writing a compensating
+// entry linked to the original. Reversing a win debits the balance and is
+// subject to the same insufficient-balance rule as a lose; there is no
+// overdraft. A transaction can be reversed at most once. A round transaction
+// is also taken back out of its round, and the reversal is linked to it.
+func ReverseTransaction(userID uint64, transactionID string) (*TransactionResult, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the user first, in the same order as ProcessTransaction
+	if _, err := lockUser(tx, userID); err != nil {
+		return nil, err
+	}
+
+	var (
+		amount                      Money
+		cash, bonus                 *Money
+		state, sourceType, currency string
+		bonusGrant                  bool
+		reverses, transfer, round   sql.NullString
+	)
+	err = tx.QueryRow(`
+		SELECT amount, cash_amount, bonus_amount, state, source_type, currency, bonus_grant, reverses_transaction_id,
+			transfer_id, round_id
+		FROM transactions WHERE transaction_id = $1 AND user_id = $2`, transactionID, userID).
+		Scan(&amount, &cash, &bonus, &state, &sourceType, &currency, &bonusGrant, &reverses, &transfer, &round)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransactionNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction: %w", err)
+	}
+	if reverses.Valid {
+		return nil, ErrNotReversible
+	}
+	if transfer.Valid {
+		return nil, ErrTransferLeg
+	}
+
+	wallet, err := lockWallet(tx, userID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claim the reversal ID; clients cannot use it, so only a second reversal
+	// of the same transaction finds it taken
+	reversal := transactionInput{
+		UserID:        userID,
+		TransactionID: ReversalID(transactionID),
+		Amount:        amount,
+		State:         oppositeState(state),
+		SourceType:    sourceType,
+		Currency:      currency,
+		Bonus:         bonusGrant, // keeps the promotions account as counterpart
+	}
+	reversalID, reversalState := reversal.TransactionID, reversal.State
+	res, err := tx.Exec(`
+		INSERT INTO transactions (transaction_id, user_id, amount, state, source_type, currency, request_fingerprint, reverses_transaction_id,
+			round_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (transaction_id) DO NOTHING`,
+		reversalID, userID, amount, reversalState, sourceType, currency, requestFingerprint(withoutBonus(reversal)), transactionID,
+		round)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert reversal: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to insert reversal: %w", err)
+	} else if n == 0 {
+		return nil, ErrAlreadyReversed
+	}
+
+	// Take the original back out of its round
+	if round.Valid {
+		if err := reverseRoundTx(tx, userID, round.String, state, amount); err != nil {
+			return nil, err
+		}
+	}
+
+	// Put the amount back on the sub-balances it came from
+	previous := wallet.Balance
+	split, err := wallet.reverse(splitOf(amount, cash, bonus), state)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveWallet(tx, wallet); err != nil {
+		return nil, err
+	}
+	err = recordBalanceChange(tx, balanceChange{
+		Event:         EventTransactionReversed,
+		UserID:        userID,
+		Currency:      currency,
+		Previous:      previous,
+		New:           wallet.Balance,
+		SourceType:    sourceType,
+		Reason:        "reversal",
+		TransactionID: reversalID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := recordOutcome(tx, reversalID, wallet.Balance, split); err != nil {
+		return nil, err
+	}
+
+	entry := transactionEntry(reversal)
+	entry.Description = fmt.Sprintf("reversal of %s", transactionID)
+	if err := postJournalEntry(tx, entry); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		err = mapUniqueViolation(err, "failed to commit transaction")
+		if err == ErrDuplicateTransaction {
+			return nil, ErrAlreadyReversed
+		}
+		return nil, err
+	}
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id":        userID,
+		"transaction_id": transactionID,
+		"reversal_id":    reversalID,
+		"amount":         amount.String(),
+		"state":          reversalState,
+		"source_type":    sourceType,
+		"currency":       currency,
+	}).Info("Reversed transaction")
+
+	return &TransactionResult{TransactionID: reversalID, Balance: &wallet.Balance}, nil
+}
@@ -0,0 +1,127 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"entain-app/internal/db"
+)
+
+var (
+	ErrRoundNotFound = errors.New("round not found")
+	ErrRoundNotOpen  = errors.New("settlement must reference an open round")
+	ErrRoundCurrency = errors.New("round is in a different currency")
+)
+
+const (
+	RoundOpen    = "open"
+	RoundSettled = "settled"
+)
+
+// Round links the stakes and payouts of one game round.
+type Round struct {
+	RoundID   string     `json:"roundId"`
+	UserID    uint64     `json:"userId"`
+	GameID    string     `json:"gameId,omitempty"`
+	Currency  string     `json:"currency"`
+	Status    string     `json:"status"`
+	Stake     Money      `json:"stake"`
+	Payout    Money      `json:"payout"`
+	Net       Money      `json:"net"` // payout minus stake, from the player's side
+	CreatedAt time.Time  `json:"createdAt"`
+	SettledAt *time.Time `json:"settledAt,omitempty"`
+}
+
+// applyRoundTx records a claimed transaction against its round inside tx and
+// links the two. Rounds are per user, so players sharing a provider's round
+// ID each get their own. A lose stakes into the round, opening it on first
+// use; a win adds the payout and settles it. Both require the round to be
+// open, and EndRound settles a round without a payout. Every transaction of
+// a round uses its currency.
+func applyRoundTx(tx *sql.Tx, in transactionInput) error {
+	var status, currency string
+	err := tx.QueryRow(`SELECT status, currency FROM rounds WHERE round_id = $1 AND user_id = $2 FOR UPDATE`,
+		in.RoundID, in.UserID).Scan(&status, &currency)
+	switch {
+	case err == sql.ErrNoRows:
+		if in.State != "lose" {
+			return ErrRoundNotOpen
+		}
+		_, err = tx.Exec(`
+			INSERT INTO rounds (round_id, user_id, game_id, currency, stake) VALUES ($1, $2, $3, $4, 0)`,
+			in.RoundID, in.UserID, nullString(in.GameID), in.Currency)
+		if err != nil {
+			return fmt.Errorf("failed to open round: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to fetch round: %w", err)
+	case status != RoundOpen:
+		return ErrRoundNotOpen
+	case currency != in.Currency:
+		return ErrRoundCurrency
+	}
+
+	settle := in.State == "win" || in.EndRound
+	column := "stake"
+	if in.State == "win" {
+		column = "payout"
+	}
+	_, err = tx.Exec(fmt.Sprintf(`
+		UPDATE rounds
+		SET %[1]s = %[1]s + $1,
+			status = CASE WHEN $2 THEN 'settled' ELSE status END,
+			settled_at = CASE WHEN $2 THEN CURRENT_TIMESTAMP ELSE settled_at END
+		WHERE round_id = $3 AND user_id = $4`, column), in.Amount, settle, in.RoundID, in.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to update round: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE transactions SET round_id = $1 WHERE transaction_id = $2`, in.RoundID, in.TransactionID)
+	if err != nil {
+		return fmt.Errorf("failed to link round: %w", err)
+	}
+	return nil
+}
+
+// reverseRoundTx takes a reversed transaction back out of its round inside
+// tx: a reversed lose comes off the stake and a reversed win off the payout.
+// The round keeps its status, so a settled round stays settled.
+func reverseRoundTx(tx *sql.Tx, userID uint64, roundID, state string, amount Money) error {
+	column := "stake"
+	if state == "win" {
+		column = "payout"
+	}
+	_, err := tx.Exec(fmt.Sprintf(`UPDATE rounds SET %[1]s = %[1]s - $1 WHERE round_id = $2 AND user_id = $3`, column),
+		amount, roundID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update round: %w", err)
+	}
+	return nil
+}
+
+// GetRound returns a round owned by the user with its net result.
+func GetRound(userID uint64, roundID string) (*Round, error) {
+	var r Round
+	var gameID sql.NullString
+	var settledAt sql.NullTime
+	err := db.DB.QueryRow(`
+		SELECT round_id, user_id, game_id, currency, status, stake, payout, created_at, settled_at
+		FROM rounds WHERE round_id = $1 AND user_id = $2`, roundID, userID).
+		Scan(&r.RoundID, &r.UserID, &gameID, &r.Currency, &r.Status, &r.Stake, &r.Payout, &r.CreatedAt, &settledAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRoundNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch round: %w", err)
+	}
+
+	r.GameID = gameID.String
+	r.Net = r.Payout - r.Stake
+	r.CreatedAt = r.CreatedAt.UTC()
+	if settledAt.Valid {
+		t := settledAt.Time.UTC()
+		r.SettledAt = &t
+	}
+	return &r, nil
+}
@@ -2,9 +2,11 @@ package user
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
-	"strconv"
+	"strings"
+	"time"
 
 	"entain-app/internal/db"
 	"entain-app/pkg/utils"
@@ -15,89 +17,496 @@ var (
 	ErrInvalidAmount        = errors.New("invalid amount format")
 	ErrInsufficientBalance  = errors.New("insufficient balance")
 	ErrDuplicateTransaction = errors.New("duplicate transaction")
+	ErrTransactionNotFound  = errors.New("transaction not found")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+
+	ErrReservedTransactionID = errors.New("transactionId must not start with " + strings.Join(reservedPrefixes, ", "))
+)
+
+// reservedPrefixes are the transaction ID prefixes of the entries the service
+// writes itself, so a client cannot take the ID of one before it is written.
+var reservedPrefixes = []string{reversalPrefix, capturePrefix, transferPrefix}
+
+// isReservedTransactionID reports whether id starts with a reserved prefix.
+func isReservedTransactionID(id string) bool {
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 200
+
+	// pgTimestampLayout matches TIMESTAMP (without time zone) at microsecond precision.
+	pgTimestampLayout = "2006-01-02 15:04:05.999999"
 )
 
-func ProcessTransaction(userID uint64, req TransactionRequest, sourceType string) error {
+// transactionInput is a validated transaction request bound to a user.
+type transactionInput struct {
+	UserID        uint64
+	TransactionID string
+	Amount        Money
+	State         string
+	SourceType    string
+	Currency      string
+	RoundID       string
+	GameID        string
+	EndRound      bool
+	Bonus         bool   // credits the bonus sub-balance (GrantBonus)
+	Wagering      Money  // stakes required before a granted bonus converts
+	Capture       bool   // settles a reservation authorized earlier
+	Actor         string // recorded in the balance audit; defaults to ActorAPI
+}
+
+// ProcessTransaction applies a win/lose to the user's wallet in the request
+// currency, or the default currency when none is given. Reusing a
+// transaction ID with the same payload replays the original result; reusing
+// it with a different payload fails with a *ConflictError.
+func ProcessTransaction(userID uint64, req TransactionRequest, sourceType string) (*TransactionResult, error) {
+	in, err := newTransactionInput(userID, req, sourceType)
+	if err != nil {
+		return nil, err
+	}
+	return processTransaction(in)
+}
+
+// newTransactionInput validates the transaction ID, amount and currency of
+// a request and binds it to a user.
+func newTransactionInput(userID uint64, req TransactionRequest, sourceType string) (transactionInput, error) {
+	if isReservedTransactionID(req.TransactionID) {
+		return transactionInput{}, ErrReservedTransactionID
+	}
+
 	// Validate amount
-	amount, err := strconv.ParseFloat(req.Amount, 64)
+	amount, err := ParseMoney(req.Amount)
+	if err == ErrAmountOverflow {
+		return transactionInput{}, ErrAmountOverflow
+	}
 	if err != nil || amount <= 0 {
-		return ErrInvalidAmount
+		return transactionInput{}, ErrInvalidAmount
+	}
+	currency := normalizeCurrency(req.Currency)
+	if err := checkCurrencyAmount(currency, amount); err != nil {
+		return transactionInput{}, err
 	}
 
-	// Check for duplicate transaction ID
-	var exists bool
-	err = db.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM transactions WHERE transaction_id = $1)`, req.TransactionID).Scan(&exists)
-	if err != nil {
-		return fmt.Errorf("failed to check transaction ID: %w", err)
+	return transactionInput{
+		UserID:        userID,
+		TransactionID: req.TransactionID,
+		Amount:        amount,
+		State:         req.State,
+		SourceType:    strings.ToLower(sourceType),
+		Currency:      currency,
+		RoundID:       req.RoundID,
+		GameID:        req.GameID,
+		EndRound:      req.EndRound,
+	}, nil
+}
+
+// processTransaction applies a validated input, answering duplicates of its
+// transaction ID with a replay or a conflict.
+func processTransaction(in transactionInput) (*TransactionResult, error) {
+	result, err := applyTransaction(in)
+	if errors.Is(err, ErrDuplicateTransaction) {
+		// Another request owns this ID; answer from what it stored
+		orig, err := findStoredTransaction(in.TransactionID)
+		if err != nil {
+			return nil, err
+		}
+		if orig == nil {
+			return nil, fmt.Errorf("duplicate transaction %q not found", in.TransactionID)
+		}
+		return replayOrConflict(orig, in)
 	}
-	if exists {
-		return ErrDuplicateTransaction
+	if err != nil {
+		return nil, err
 	}
 
+	utils.Logger.WithFields(map[string]interface{}{
+		"user_id":        in.UserID,
+		"transaction_id": in.TransactionID,
+		"amount":         in.Amount.String(),
+		"state":          in.State,
+		"source_type":    in.SourceType,
+		"currency":       in.Currency,
+		"round_id":       in.RoundID,
+		"bonus":          in.Bonus,
+	}).Info("Processed transaction")
+
+	return result, nil
+}
+
+// applyTransaction runs applyTransactionTx in its own DB transaction.
+func applyTransaction(in transactionInput) (*TransactionResult, error) {
 	tx, err := db.DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to begin db tx: %w", err)
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Get current user balance
-	var currentBalance float64
-	err = tx.QueryRow(`SELECT balance FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&currentBalance)
-	if err == sql.ErrNoRows {
-		return ErrUserNotFound
-	} else if err != nil {
-		return fmt.Errorf("failed to fetch user balance: %w", err)
+	result, err := applyTransactionTx(tx, in)
+	if err != nil {
+		return nil, err
 	}
 
-	// Recalculate balance
-	if req.State == "win" {
-		currentBalance += amount
-	} else if req.State == "lose" {
-		if currentBalance < amount {
-			return ErrInsufficientBalance
+	if err := tx.Commit(); err != nil {
+		return nil, mapUniqueViolation(err, "failed to commit transaction")
+	}
+	return result, nil
+}
+
+// applyTransactionTx claims the transaction ID and updates the wallet inside
+// tx. The claim is an insert-first ON CONFLICT DO NOTHING taken right after
+// the user lock and before anything else, so two concurrent requests with the
+// same ID can never both apply: the loser waits for the winner to commit and
+// gets ErrDuplicateTransaction, having changed nothing. The account gates only
+// apply to new transactions, so a retry still replays once the account is
+// suspended or excluded.
+func applyTransactionTx(tx *sql.Tx, in transactionInput) (*TransactionResult, error) {
+	// Lock the user, so that the user's transactions apply one at a time
+	status, err := lockUser(tx, in.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claim the transaction ID along with the request fingerprint; the round
+	// is linked once it exists
+	res, err := tx.Exec(`
+		INSERT INTO transactions (transaction_id, user_id, amount, state, source_type, currency, request_fingerprint,
+			game_id, end_round, bonus_grant, wagering_requirement)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (transaction_id) DO NOTHING`,
+		in.TransactionID, in.UserID, in.Amount, in.State, in.SourceType, in.Currency, requestFingerprint(in),
+		nullString(in.GameID), in.EndRound, in.Bonus, nullWagering(in))
+	if err != nil {
+		return nil, mapUniqueViolation(err, "failed to insert transaction")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to insert transaction: %w", err)
+	} else if n == 0 {
+		return nil, ErrDuplicateTransaction
+	}
+
+	// A new transaction needs an active, non-excluded account
+	if status != StatusActive {
+		return nil, ErrAccountNotActive
+	}
+	if err := checkExclusionTx(tx, in); err != nil {
+		return nil, err
+	}
+
+	// Lock the wallet with the part of it held by reservations
+	wallet, err := lockWallet(tx, in.UserID, in.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open, stake or settle the game round
+	if in.RoundID != "" {
+		if err := applyRoundTx(tx, in); err != nil {
+			return nil, err
 		}
-		currentBalance -= amount
-	} else {
-		return errors.New("invalid state value")
 	}
 
-	// Update balance
-	_, err = tx.Exec(`UPDATE users SET balance = $1 WHERE id = $2`, currentBalance, userID)
+	// Enforce the player's deposit, loss and wager limits
+	if err := checkLimitsTx(tx, in); err != nil {
+		return nil, err
+	}
+
+	// Recalculate balance and its cash/bonus split
+	previous := wallet.Balance
+	split, err := wallet.apply(in)
 	if err != nil {
-		return fmt.Errorf("failed to update balance: %w", err)
+		return nil, err
 	}
 
-	// Insert transaction
-	_, err = tx.Exec(`
-		INSERT INTO transactions (transaction_id, user_id, amount, state, source_type)
-		VALUES ($1, $2, $3, $4, $5)`,
-		req.TransactionID, userID, amount, req.State, sourceType)
+	// Update balance, its audit trail and the outbox
+	if err := saveWallet(tx, wallet); err != nil {
+		return nil, err
+	}
+	err = recordBalanceChange(tx, balanceChange{
+		Event:         EventTransactionProcessed,
+		UserID:        in.UserID,
+		Currency:      in.Currency,
+		Previous:      previous,
+		New:           wallet.Balance,
+		Actor:         in.Actor,
+		SourceType:    in.SourceType,
+		Reason:        transactionReason(in),
+		TransactionID: in.TransactionID,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to insert transaction: %w", err)
+		return nil, err
+	}
+	if err := recordOutcome(tx, in.TransactionID, wallet.Balance, split); err != nil {
+		return nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	// Record the balanced journal entry behind the balance change
+	if err := postJournalEntry(tx, transactionEntry(in)); err != nil {
+		return nil, err
 	}
 
-	utils.Logger.WithFields(map[string]interface{}{
-		"user_id":        userID,
-		"transaction_id": req.TransactionID,
-		"amount":         amount,
-		"state":          req.State,
-		"source_type":    sourceType,
-	}).Info("Processed transaction")
+	return &TransactionResult{TransactionID: in.TransactionID, Balance: &wallet.Balance}, nil
+}
 
+// saveWallet writes a wallet's balance and bonus state back inside tx.
+func saveWallet(tx *sql.Tx, w *Wallet) error {
+	_, err := tx.Exec(`
+		UPDATE wallets SET balance = $1, bonus = $2, wagering_required = $3, wagering_progress = $4
+		WHERE user_id = $5 AND currency = $6`,
+		w.Balance, w.Bonus, w.WageringRequired, w.WageringProgress, w.UserID, w.Currency)
+	if err != nil {
+		return fmt.Errorf("failed to update balance: %w", err)
+	}
+	return nil
+}
+
+// recordOutcome stores the balance a transaction left behind and how its
+// amount split between cash and bonus.
+func recordOutcome(tx *sql.Tx, transactionID string, balanceAfter Money, split Split) error {
+	_, err := tx.Exec(`
+		UPDATE transactions SET balance_after = $1, cash_amount = $2, bonus_amount = $3
+		WHERE transaction_id = $4`, balanceAfter, split.Cash, split.Bonus, transactionID)
+	if err != nil {
+		return fmt.Errorf("failed to record balance after: %w", err)
+	}
 	return nil
 }
 
+// nullWagering stores a wagering requirement only for bonus grants.
+func nullWagering(in transactionInput) interface{} {
+	if !in.Bonus {
+		return nil
+	}
+	return in.Wagering
+}
+
+// nullString maps "" to SQL NULL for optional text columns.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// findStoredTransaction loads the original of a transaction ID, or nil if
+// the ID has not been used yet.
+func findStoredTransaction(transactionID string) (*storedTransaction, error) {
+	t := storedTransaction{TransactionID: transactionID}
+	var fingerprint, balanceAfter, roundID, gameID sql.NullString
+	err := db.DB.QueryRow(`
+		SELECT user_id, amount, state, source_type, currency, request_fingerprint, balance_after, round_id, game_id,
+			end_round, bonus_grant, COALESCE(wagering_requirement, 0)
+		FROM transactions WHERE transaction_id = $1`, transactionID).
+		Scan(&t.UserID, &t.Amount, &t.State, &t.SourceType, &t.Currency, &fingerprint, &balanceAfter, &roundID, &gameID,
+			&t.EndRound, &t.Bonus, &t.Wagering)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check transaction ID: %w", err)
+	}
+
+	t.Fingerprint = fingerprint.String
+	t.RoundID = roundID.String
+	t.GameID = gameID.String
+	if balanceAfter.Valid {
+		m, err := ParseMoney(balanceAfter.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check transaction ID: %w", err)
+		}
+		t.BalanceAfter = &m
+	}
+	return &t, nil
+}
+
+// GetUserBalance returns the user's balance in the default currency.
 func GetUserBalance(userID uint64) (*User, error) {
-	var u User
-	err := db.DB.QueryRow(`SELECT id, balance FROM users WHERE id = $1`, userID).Scan(&u.ID, &u.Balance)
+	wallets, err := ListWallets(userID, DefaultCurrency())
+	if err != nil {
+		return nil, err
+	}
+	w := wallets[0]
+	return &User{ID: w.UserID, Balance: w.Balance, Reserved: w.Reserved}, nil
+}
+
+// ListTransactions returns a page of the user's transactions, newest first.
+// Pages are keyed on (created_at, transaction_id) so inserts never shift them.
+func ListTransactions(userID uint64, f TransactionFilter) ([]Transaction, string, error) {
+	if err := ensureUserExists(userID); err != nil {
+		return nil, "", err
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultHistoryLimit
+	}
+	if f.Limit > MaxHistoryLimit {
+		f.Limit = MaxHistoryLimit
+	}
+
+	conds := []string{"user_id = $1"}
+	args := []interface{}{userID}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.State != "" {
+		add("state = $%d", f.State)
+	}
+	if f.SourceType != "" {
+		add("source_type = $%d", strings.ToLower(f.SourceType))
+	}
+	if f.Currency != "" {
+		add("currency = $%d", strings.ToUpper(f.Currency))
+	}
+	if f.MinAmount != nil {
+		add("amount >= $%d", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		add("amount <= $%d", *f.MaxAmount)
+	}
+	if f.From != nil {
+		add("created_at >= $%d::timestamp", f.From.UTC().Format(pgTimestampLayout))
+	}
+	if f.To != nil {
+		add("created_at < $%d::timestamp", f.To.UTC().Format(pgTimestampLayout))
+	}
+	if f.Cursor != "" {
+		createdAt, txID, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, createdAt.Format(pgTimestampLayout), txID)
+		conds = append(conds, fmt.Sprintf("(created_at, transaction_id) < ($%d::timestamp, $%d)", len(args)-1, len(args)))
+	}
+
+	args = append(args, f.Limit+1)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM transactions t
+		WHERE %s
+		ORDER BY created_at DESC, transaction_id DESC
+		LIMIT $%d`, transactionColumns, strings.Join(conds, " AND "), len(args))
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list transactions: %w", err)
+	}
+	defer rows.Close()
+
+	txns := make([]Transaction, 0, f.Limit+1)
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		txns = append(txns, *t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to list transactions: %w", err)
+	}
+
+	var next string
+	if len(txns) > f.Limit {
+		txns = txns[:f.Limit]
+		last := txns[len(txns)-1]
+		next = encodeCursor(last.CreatedAt, last.TransactionID)
+	}
+	return txns, next, nil
+}
+
+// GetTransaction returns a single transaction owned by the user, including
+// the balance it left behind, so callers can reconcile after a timeout.
+func GetTransaction(userID uint64, transactionID string) (*Transaction, error) {
+	row := db.DB.QueryRow(`
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		WHERE transaction_id = $1 AND user_id = $2`, transactionID, userID)
+	t, err := scanTransaction(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTransactionNotFound
+	}
+	return t, err
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// transactionColumns is the select list read by scanTransaction; queries
+// alias transactions as t.
+const transactionColumns = `t.transaction_id, t.user_id, t.amount, t.state, t.source_type, t.currency, t.balance_after,
+		t.cash_amount, t.bonus_amount,
+		t.reverses_transaction_id, t.round_id, t.game_id,
+		(SELECT r.transaction_id FROM transactions r WHERE r.reverses_transaction_id = t.transaction_id),
+		t.created_at`
+
+// scanTransaction reads the column list shared by the transaction queries.
+func scanTransaction(row rowScanner) (*Transaction, error) {
+	var t Transaction
+	var balanceAfter, cash, bonus, reverses, roundID, gameID, reversedBy sql.NullString
+	err := row.Scan(&t.TransactionID, &t.UserID, &t.Amount, &t.State, &t.SourceType, &t.Currency, &balanceAfter,
+		&cash, &bonus, &reverses, &roundID, &gameID, &reversedBy, &t.CreatedAt)
 	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
+		return nil, err
 	} else if err != nil {
-		return nil, fmt.Errorf("failed to get user balance: %w", err)
+		return nil, fmt.Errorf("failed to scan transaction: %w", err)
+	}
+	for _, c := range []struct {
+		src sql.NullString
+		dst **Money
+	}{{balanceAfter, &t.BalanceAfter}, {cash, &t.CashAmount}, {bonus, &t.BonusAmount}} {
+		if c.src.Valid {
+			m, err := ParseMoney(c.src.String)
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan transaction: %w", err)
+			}
+			*c.dst = &m
+		}
+	}
+	t.ReversesTransactionID = reverses.String
+	t.ReversedBy = reversedBy.String
+	t.RoundID = roundID.String
+	t.GameID = gameID.String
+	t.CreatedAt = t.CreatedAt.UTC()
+	return &t, nil
+}
+
+func ensureUserExists(userID uint64) error {
+	var exists bool
+	err := db.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check user: %w", err)
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func encodeCursor(createdAt time.Time, transactionID string) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + transactionID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	ts, txID, ok := strings.Cut(string(raw), "|")
+	if !ok || txID == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
 	}
-	return &u, nil
+	return createdAt.UTC(), txID, nil
 }
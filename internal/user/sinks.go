@@ -0,0 +1,85 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Sink receives events from the outbox relay. Publish returns once the
+// event is durably handed over; an error makes the relay retry it later.
+type Sink interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// MultiSink publishes each event to every sink in turn. If one fails the
+// event fails, and the sinks before it see it again on the retry.
+type MultiSink []Sink
+
+func (m MultiSink) Publish(ctx context.Context, e Event) error {
+	for _, s := range m {
+		if err := s.Publish(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChannelSink hands events to in-process consumers over C. Publish blocks
+// until a consumer takes the event, so a slow consumer slows the relay down
+// rather than losing events.
+type ChannelSink struct {
+	C chan Event
+}
+
+func NewChannelSink(buffer int) *ChannelSink {
+	return &ChannelSink{C: make(chan Event, buffer)}
+}
+
+func (s *ChannelSink) Publish(ctx context.Context, e Event) error {
+	select {
+	case s.C <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FileSink appends each event to a file as one JSON line (NDJSON), synced
+// to disk before Publish returns.
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event file: %w", err)
+	}
+	return &FileSink{f: f}, nil
+}
+
+func (s *FileSink) Publish(ctx context.Context, e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(line); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync event file: %w", err)
+	}
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,170 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+var (
+	ErrInvalidTransfer  = errors.New("transfer needs two different users")
+	ErrTransferConflict = errors.New("transfer ID already used with a different payload")
+	ErrTransferNotFound = errors.New("transfer not found")
+	ErrTransferLeg      = errors.New("transfer legs cannot be reversed on their own")
+)
+
+// Transfer moves funds from one user's wallet to another's in one currency.
+// Each side is a transaction row linked to the transfer by transfer_id.
+type Transfer struct {
+	TransferID          string    `json:"transferId"`
+	FromUserID          uint64    `json:"fromUserId"`
+	ToUserID            uint64    `json:"toUserId"`
+	Amount              Money     `json:"amount"`
+	Currency            string    `json:"currency"`
+	DebitTransactionID  string    `json:"debitTransactionId"`
+	CreditTransactionID string    `json:"creditTransactionId"`
+	CreatedAt           time.Time `json:"createdAt"`
+	Replayed            bool      `json:"-"`
+}
+
+// transferPrefix starts the ID of both legs of every transfer.
+const transferPrefix = "transfer:"
+
+// TransferDebitID and TransferCreditID are the transaction IDs of the two
+// sides of a transfer.
+func TransferDebitID(transferID string) string {
+	return transferPrefix + transferID + ":debit"
+}
+
+func TransferCreditID(transferID string) string {
+	return transferPrefix + transferID + ":credit"
+}
+
+// CreateTransfer debits the sender and credits the recipient in a single DB
+// transaction. Both user rows are locked in ascending ID order before either
+// wallet is touched, so opposite transfers between the same pair cannot
+// deadlock. Only cash can be transferred. Reusing a transfer ID with the same
+// payload replays the original transfer.
+func CreateTransfer(req TransferRequest) (*Transfer, error) {
+	if req.FromUserID == 0 || req.ToUserID == 0 || req.FromUserID == req.ToUserID {
+		return nil, ErrInvalidTransfer
+	}
+	amount, err := ParseMoney(req.Amount)
+	if err == ErrAmountOverflow {
+		return nil, ErrAmountOverflow
+	}
+	if err != nil || amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	currency := normalizeCurrency(req.Currency)
+	if err := checkCurrencyAmount(currency, amount); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	first, second := req.FromUserID, req.ToUserID
+	if first > second {
+		first, second = second, first
+	}
+	for _, id := range []uint64{first, second} {
+		if _, err := lockUser(tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	// Claim the transfer ID first, as ProcessTransaction does
+	res, err := tx.Exec(`
+		INSERT INTO transfers (transfer_id, from_user_id, to_user_id, amount, currency)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (transfer_id) DO NOTHING`,
+		req.TransferID, req.FromUserID, req.ToUserID, amount, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert transfer: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to insert transfer: %w", err)
+	} else if n == 0 {
+		tx.Rollback()
+		existing, err := GetTransfer(req.TransferID)
+		if err != nil {
+			return nil, err
+		}
+		if existing.FromUserID != req.FromUserID || existing.ToUserID != req.ToUserID ||
+			existing.Amount != amount || existing.Currency != currency {
+			return nil, ErrTransferConflict
+		}
+		existing.Replayed = true
+		return existing, nil
+	}
+
+	legs := []transactionInput{
+		{UserID: req.FromUserID, TransactionID: TransferDebitID(req.TransferID), State: "lose"},
+		{UserID: req.ToUserID, TransactionID: TransferCreditID(req.TransferID), State: "win"},
+	}
+	for _, in := range legs {
+		in.Amount, in.SourceType, in.Currency = amount, "transfer", currency
+		if _, err := applyTransactionTx(tx, in); err == ErrDuplicateTransaction {
+			return nil, ErrTransferConflict
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE transactions SET transfer_id = $1 WHERE transaction_id IN ($2, $3)`,
+		req.TransferID, legs[0].TransactionID, legs[1].TransactionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link transfer: %w", err)
+	}
+
+	t, err := scanTransfer(tx.QueryRow(`SELECT `+transferColumns+` FROM transfers WHERE transfer_id = $1`, req.TransferID))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		err = mapUniqueViolation(err, "failed to commit transaction")
+		if err == ErrDuplicateTransaction {
+			return nil, ErrTransferConflict
+		}
+		return nil, err
+	}
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"transfer_id":  t.TransferID,
+		"from_user_id": t.FromUserID,
+		"to_user_id":   t.ToUserID,
+		"amount":       amount.String(),
+		"currency":     currency,
+	}).Info("Processed transfer")
+
+	return t, nil
+}
+
+// GetTransfer returns a stored transfer.
+func GetTransfer(transferID string) (*Transfer, error) {
+	return scanTransfer(db.DB.QueryRow(`SELECT `+transferColumns+` FROM transfers WHERE transfer_id = $1`, transferID))
+}
+
+const transferColumns = `transfer_id, from_user_id, to_user_id, amount, currency, created_at`
+
+func scanTransfer(row rowScanner) (*Transfer, error) {
+	var t Transfer
+	err := row.Scan(&t.TransferID, &t.FromUserID, &t.ToUserID, &t.Amount, &t.Currency, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransferNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch transfer: %w", err)
+	}
+	t.DebitTransactionID = TransferDebitID(t.TransferID)
+	t.CreditTransactionID = TransferCreditID(t.TransferID)
+	t.CreatedAt = t.CreatedAt.UTC()
+	return &t, nil
+}
@@ -0,0 +1,233 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"entain-app/configs"
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrWalletNotFound      = errors.New("no wallet for currency")
+	ErrAmountPrecision     = errors.New("amount has more decimal places than the currency allows")
+)
+
+var walletCfg = configs.LoadWalletConfig()
+
+// DefaultCurrency is the currency used when a request does not name one.
+func DefaultCurrency() string {
+	return walletCfg.DefaultCurrency
+}
+
+// Wallet holds a user's funds in one currency.
+type Wallet struct {
+	UserID     uint64
+	Currency   string
+	MinorUnits int
+	Balance    Money // total, including reserved funds
+	Reserved   Money // held by open reservations
+	Bonus      Money // part of Balance that is not withdrawable yet
+	CreatedAt  time.Time
+
+	// Part of Reserved held by withdrawals, which can only hold cash
+	ReservedCash Money
+
+	// Stakes needed before the bonus converts to cash, and staked so far
+	WageringRequired Money
+	WageringProgress Money
+}
+
+// Available is the part of the balance not held by reservations.
+func (w *Wallet) Available() Money {
+	return w.Balance - w.Reserved
+}
+
+// Response formats the wallet with its currency's precision.
+func (w *Wallet) Response() WalletResponse {
+	return WalletResponse{
+		Currency:         w.Currency,
+		Balance:          w.Balance.Format(w.MinorUnits),
+		AvailableBalance: w.Available().Format(w.MinorUnits),
+		ReservedBalance:  w.Reserved.Format(w.MinorUnits),
+		CashBalance:      w.Cash().Format(w.MinorUnits),
+		BonusBalance:     w.Bonus.Format(w.MinorUnits),
+		WageringRequired: w.WageringRequired.Format(w.MinorUnits),
+		WageringProgress: w.WageringProgress.Format(w.MinorUnits),
+	}
+}
+
+// normalizeCurrency upper-cases a currency code, defaulting when empty.
+func normalizeCurrency(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency()
+	}
+	return code
+}
+
+// minorUnitsCache maps currency codes to their minor units. Currencies are
+// reference data seeded by migrations, so entries never go stale.
+var minorUnitsCache sync.Map
+
+// currencyMinorUnits returns the number of decimal places of a currency, or
+// ErrUnsupportedCurrency if it is not known.
+func currencyMinorUnits(currency string) (int, error) {
+	if v, ok := minorUnitsCache.Load(currency); ok {
+		return v.(int), nil
+	}
+	var units int
+	err := db.DB.QueryRow(`SELECT minor_units FROM currencies WHERE code = $1`, currency).Scan(&units)
+	if err == sql.ErrNoRows {
+		return 0, ErrUnsupportedCurrency
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to look up currency: %w", err)
+	}
+	minorUnitsCache.Store(currency, units)
+	return units, nil
+}
+
+// checkCurrencyAmount rejects unknown currencies and amounts finer than the
+// currency's minor unit, e.g. "10.50" in JPY.
+func checkCurrencyAmount(currency string, amount Money) error {
+	units, err := currencyMinorUnits(currency)
+	if err != nil {
+		return err
+	}
+	if !amount.FitsMinorUnits(units) {
+		return ErrAmountPrecision
+	}
+	return nil
+}
+
+// lockUser locks the user row, the first lock taken by every balance change,
+// and returns the account status.
+func lockUser(tx *sql.Tx, userID uint64) (string, error) {
+	var status string
+	err := tx.QueryRow(`SELECT status FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("failed to lock user: %w", err)
+	}
+	return status, nil
+}
+
+// lockWallet locks one of the user's wallets. Callers lock the user first.
+func lockWallet(tx *sql.Tx, userID uint64, currency string) (*Wallet, error) {
+	return scanWallet(tx.QueryRow(`
+		SELECT `+walletColumns+`
+		FROM wallets w JOIN currencies c ON c.code = w.currency
+		WHERE w.user_id = $1 AND w.currency = $2
+		FOR UPDATE OF w`, userID, currency))
+}
+
+// OpenWallet opens a zero-balance wallet in currency for an active user. It
+// reports false if the wallet already existed.
+func OpenWallet(userID uint64, currency string) (*Wallet, bool, error) {
+	currency = normalizeCurrency(currency)
+	if _, err := currencyMinorUnits(currency); err != nil {
+		return nil, false, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	status, err := lockUser(tx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if status != StatusActive {
+		return nil, false, ErrAccountNotActive
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO wallets (user_id, currency) VALUES ($1, $2)
+		ON CONFLICT (user_id, currency) DO NOTHING`, userID, currency)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open wallet: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open wallet: %w", err)
+	}
+
+	w, err := lockWallet(tx, userID, currency)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if n > 0 {
+		utils.Logger.WithFields(map[string]interface{}{
+			"user_id":  userID,
+			"currency": currency,
+		}).Info("Opened wallet")
+	}
+	return w, n > 0, nil
+}
+
+// ListWallets returns the user's wallets ordered by currency, or only the
+// one in currency when it is set.
+func ListWallets(userID uint64, currency string) ([]Wallet, error) {
+	if err := ensureUserExists(userID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + walletColumns + ` FROM wallets w JOIN currencies c ON c.code = w.currency WHERE w.user_id = $1`
+	args := []interface{}{userID}
+	if currency != "" {
+		query += ` AND w.currency = $2`
+		args = append(args, strings.ToUpper(currency))
+	}
+	rows, err := db.DB.Query(query+` ORDER BY w.currency`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wallets: %w", err)
+	}
+	defer rows.Close()
+
+	var wallets []Wallet
+	for rows.Next() {
+		w, err := scanWallet(rows)
+		if err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, *w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list wallets: %w", err)
+	}
+	if currency != "" && len(wallets) == 0 {
+		return nil, ErrWalletNotFound
+	}
+	return wallets, nil
+}
+
+// walletColumns is the select list read by scanWallet; queries alias
+// wallets as w and join currencies as c.
+const walletColumns = `w.user_id, w.currency, c.minor_units, w.balance, w.reserved, w.bonus,
+		w.wagering_required, w.wagering_progress, w.created_at, w.reserved_cash`
+
+func scanWallet(row rowScanner) (*Wallet, error) {
+	var w Wallet
+	err := row.Scan(&w.UserID, &w.Currency, &w.MinorUnits, &w.Balance, &w.Reserved, &w.Bonus,
+		&w.WageringRequired, &w.WageringProgress, &w.CreatedAt, &w.ReservedCash)
+	if err == sql.ErrNoRows {
+		return nil, ErrWalletNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch wallet: %w", err)
+	}
+	w.CreatedAt = w.CreatedAt.UTC()
+	return &w, nil
+}
@@ -0,0 +1,335 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"entain-app/configs"
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead" // gave up; a copy is in webhook_dead_letters
+)
+
+var webhookCfg = configs.LoadWebhookConfig()
+
+// webhookWake lets WebhookSink start an idle delivery worker without
+// waiting for the next poll.
+var webhookWake = make(chan struct{}, 1)
+
+var webhookClient = &http.Client{Timeout: webhookCfg.Timeout}
+
+// WebhookDelivery is one event queued for one subscription, with the
+// outcome of its latest attempt.
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int64      `json:"webhookId"`
+	EventID        int64      `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"lastStatusCode,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+
+	body, url, secret string
+}
+
+// SignWebhook returns the Webhook-Signature header value for a body sent at
+// timestamp: "sha256=" and the hex HMAC-SHA256, keyed with the subscription
+// secret, of the timestamp, a dot and the body.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ListWebhookDeliveries returns a page of a subscription's delivery log,
+// newest first, optionally only those with a status.
+func ListWebhookDeliveries(webhookID int64, status, cursor string, limit int) ([]WebhookDelivery, string, error) {
+	if _, err := GetWebhook(webhookID); err != nil {
+		return nil, "", err
+	}
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+
+	conds := []string{"webhook_id = $1"}
+	args := []interface{}{webhookID}
+	if status != "" {
+		args = append(args, status)
+		conds = append(conds, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if cursor != "" {
+		before, err := decodeIDCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, before)
+		conds = append(conds, fmt.Sprintf("id < $%d", len(args)))
+	}
+
+	args = append(args, limit+1)
+	rows, err := db.DB.Query(fmt.Sprintf(`
+		SELECT %s FROM webhook_deliveries d
+		WHERE %s
+		ORDER BY id DESC
+		LIMIT $%d`, deliveryColumns, strings.Join(conds, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]WebhookDelivery, 0, limit+1)
+	for rows.Next() {
+		d, err := scanDelivery(rows, false)
+		if err != nil {
+			return nil, "", err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to list deliveries: %w", err)
+	}
+
+	var next string
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		next = encodeIDCursor(deliveries[len(deliveries)-1].ID)
+	}
+	return deliveries, next, nil
+}
+
+// StartWebhookWorkers starts the pool that sends pending deliveries.
+func StartWebhookWorkers(ctx context.Context) {
+	for i := 0; i < webhookCfg.Workers; i++ {
+		go runWebhookWorker(ctx)
+	}
+}
+
+func runWebhookWorker(ctx context.Context) {
+	ticker := time.NewTicker(webhookCfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			d, err := claimDelivery()
+			if err != nil {
+				utils.Logger.WithError(err).Error("Failed to claim webhook delivery")
+				break
+			}
+			if d == nil {
+				break
+			}
+			sendDelivery(ctx, d)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+	}
+}
+
+// claimDelivery takes the next due delivery of an active subscription and
+// pushes its next attempt past the request timeout, so that no other worker
+// sends it meanwhile, or one does if this worker dies. Returns nil if none
+// is due.
+func claimDelivery() (*WebhookDelivery, error) {
+	d, err := scanDelivery(db.DB.QueryRow(`
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second', updated_at = CURRENT_TIMESTAMP
+		FROM webhook_subscriptions s
+		WHERE s.id = d.webhook_id AND d.id = (
+			SELECT q.id FROM webhook_deliveries q
+			JOIN webhook_subscriptions qs ON qs.id = q.webhook_id
+			WHERE q.status = 'pending' AND q.next_attempt_at <= CURRENT_TIMESTAMP AND qs.active
+			ORDER BY q.next_attempt_at, q.id
+			LIMIT 1
+			FOR UPDATE OF q SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns+`, d.body, s.url, s.secret`, (2*webhookCfg.Timeout).Seconds()), true)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return d, err
+}
+
+// sendDelivery makes one signed attempt and records its outcome. A 2xx
+// answer delivers it; anything else retries with exponential backoff until
+// the attempts run out, when it is dead-lettered.
+func sendDelivery(ctx context.Context, d *WebhookDelivery) {
+	code, err := postWebhook(ctx, d)
+	if err == nil && (code < 200 || code >= 300) {
+		err = fmt.Errorf("subscriber returned %d", code)
+	}
+	attempts := d.Attempts + 1
+	log := utils.Logger.WithFields(map[string]interface{}{
+		"delivery_id": d.ID,
+		"webhook_id":  d.WebhookID,
+		"event_id":    d.EventID,
+		"attempts":    attempts,
+	})
+
+	if err == nil {
+		_, err := db.DB.Exec(`
+			UPDATE webhook_deliveries
+			SET status = 'delivered', attempts = $1, last_status_code = $2, last_error = NULL,
+				delivered_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3`, attempts, code, d.ID)
+		if err != nil {
+			log.WithError(err).Error("Failed to record webhook delivery")
+		}
+		return
+	}
+
+	log = log.WithError(err)
+	if attempts >= webhookCfg.MaxAttempts {
+		if err := deadLetterDelivery(d, attempts, code, err.Error()); err != nil {
+			log.WithField("dead_letter_error", err.Error()).Error("Failed to dead-letter webhook delivery")
+			return
+		}
+		log.Warn("Webhook delivery dead-lettered")
+		return
+	}
+
+	_, dbErr := db.DB.Exec(`
+		UPDATE webhook_deliveries
+		SET attempts = $1, last_status_code = $2, last_error = $3,
+			next_attempt_at = CURRENT_TIMESTAMP + $4 * INTERVAL '1 second', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5`, attempts, nullStatusCode(code), err.Error(), webhookBackoff(attempts).Seconds(), d.ID)
+	if dbErr != nil {
+		log.WithField("db_error", dbErr.Error()).Error("Failed to record webhook attempt")
+		return
+	}
+	log.Warn("Webhook delivery failed; will retry")
+}
+
+// postWebhook sends the delivery body and returns the response status.
+func postWebhook(ctx context.Context, d *WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookCfg.Timeout)
+	defer cancel()
+	body := []byte(d.body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Webhook-Id", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("Webhook-Event", d.EventType)
+	req.Header.Set("Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("Webhook-Signature", SignWebhook(d.secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// deadLetterDelivery gives up on a delivery and copies it, with the URL it
+// was sent to, into webhook_dead_letters.
+func deadLetterDelivery(d *WebhookDelivery, attempts, code int, lastError string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE webhook_deliveries
+		SET status = 'dead', attempts = $1, last_status_code = $2, last_error = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4`, attempts, nullStatusCode(code), lastError, d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO webhook_dead_letters (delivery_id, webhook_id, url, event_id, event_type, body, attempts, last_status_code, last_error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (delivery_id) DO NOTHING`,
+		d.ID, d.WebhookID, d.url, d.EventID, d.EventType, d.body, attempts, nullStatusCode(code), lastError)
+	if err != nil {
+		return fmt.Errorf("failed to insert dead letter: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// webhookBackoff is the delay after a delivery's nth failed attempt: the
+// base delay doubled for each earlier failure, capped at the maximum.
+func webhookBackoff(attempt int) time.Duration {
+	delay := webhookCfg.BackoffBase
+	for i := 1; i < attempt && delay < webhookCfg.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > webhookCfg.BackoffMax {
+		delay = webhookCfg.BackoffMax
+	}
+	return delay
+}
+
+// nullStatusCode stores 0, meaning no response, as SQL NULL.
+func nullStatusCode(code int) interface{} {
+	if code == 0 {
+		return nil
+	}
+	return code
+}
+
+const deliveryColumns = `d.id, d.webhook_id, d.event_id, d.event_type, d.status, d.attempts,
+		COALESCE(d.last_status_code, 0), COALESCE(d.last_error, ''), d.next_attempt_at, d.delivered_at,
+		d.created_at, d.updated_at`
+
+// scanDelivery reads deliveryColumns and, withTarget, the body, URL and
+// secret needed to send it.
+func scanDelivery(row rowScanner, withTarget bool) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var next, delivered sql.NullTime
+	dest := []interface{}{&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts,
+		&d.LastStatusCode, &d.LastError, &next, &delivered, &d.CreatedAt, &d.UpdatedAt}
+	if withTarget {
+		dest = append(dest, &d.body, &d.url, &d.secret)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook delivery: %w", err)
+	}
+	if d.Status == DeliveryPending && next.Valid {
+		t := next.Time.UTC()
+		d.NextAttemptAt = &t
+	}
+	if delivered.Valid {
+		t := delivered.Time.UTC()
+		d.DeliveredAt = &t
+	}
+	d.CreatedAt = d.CreatedAt.UTC()
+	d.UpdatedAt = d.UpdatedAt.UTC()
+	return &d, nil
+}
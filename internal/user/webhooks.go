@@ -0,0 +1,338 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"entain-app/internal/db"
+	"entain-app/pkg/utils"
+)
+
+var (
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrInvalidWebhookURL   = errors.New("url must be an absolute http or https URL")
+	ErrInvalidWebhookEvent = errors.New("events must list one or more of TransactionProcessed, TransactionReversed, BalanceCorrected, BalanceThresholdCrossed")
+	ErrWebhookThreshold    = errors.New("BalanceThresholdCrossed needs a threshold")
+)
+
+// EventBalanceThresholdCrossed is derived for webhooks from a balance change
+// that moves a wallet across a subscription's threshold, either way.
+const EventBalanceThresholdCrossed = "BalanceThresholdCrossed"
+
+var webhookEvents = map[string]bool{
+	EventTransactionProcessed:    true,
+	EventTransactionReversed:     true,
+	EventBalanceCorrected:        true,
+	EventBalanceThresholdCrossed: true,
+}
+
+// Webhook is a subscription to events, for one user or (UserID 0) all.
+// Secret signs every delivery and is only returned when it is created.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	UserID    uint64    `json:"userId,omitempty"`
+	Threshold *Money    `json:"threshold,omitempty"`
+	Currency  string    `json:"currency,omitempty"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// WebhookPayload is the signed body POSTed to a subscriber. ID is the
+// outbox event ID, so receivers can drop repeats.
+type WebhookPayload struct {
+	ID        int64       `json:"id"`
+	Type      string      `json:"type"`
+	UserID    uint64      `json:"userId"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// ThresholdCrossedEvent is the data of a BalanceThresholdCrossed delivery.
+// Direction is "above" once the balance reaches the threshold and "below"
+// once it drops under it.
+type ThresholdCrossedEvent struct {
+	BalanceEvent
+	Threshold Money  `json:"threshold"`
+	Direction string `json:"direction"`
+}
+
+// CreateWebhook stores a subscription with a new signing secret.
+func CreateWebhook(req WebhookRequest) (*Webhook, error) {
+	w, err := newWebhook(req)
+	if err != nil {
+		return nil, err
+	}
+	if w.UserID != 0 {
+		if err := ensureUserExists(w.UserID); err != nil {
+			return nil, err
+		}
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := scanWebhook(db.DB.QueryRow(`
+		INSERT INTO webhook_subscriptions (url, secret, events, user_id, threshold, currency, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+webhookColumns,
+		w.URL, secret, pq.Array(w.Events), nullUserID(w.UserID), w.Threshold, nullString(w.Currency), w.Active))
+	if err != nil {
+		return nil, err
+	}
+	created.Secret = secret
+
+	utils.Logger.WithFields(map[string]interface{}{
+		"webhook_id": created.ID,
+		"url":        created.URL,
+		"events":     created.Events,
+	}).Info("Created webhook")
+
+	return created, nil
+}
+
+// UpdateWebhook replaces a subscription's settings; its secret is kept.
+func UpdateWebhook(id int64, req WebhookRequest) (*Webhook, error) {
+	w, err := newWebhook(req)
+	if err != nil {
+		return nil, err
+	}
+	if w.UserID != 0 {
+		if err := ensureUserExists(w.UserID); err != nil {
+			return nil, err
+		}
+	}
+	return scanWebhook(db.DB.QueryRow(`
+		UPDATE webhook_subscriptions
+		SET url = $1, events = $2, user_id = $3, threshold = $4, currency = $5, active = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7
+		RETURNING `+webhookColumns,
+		w.URL, pq.Array(w.Events), nullUserID(w.UserID), w.Threshold, nullString(w.Currency), w.Active, id))
+}
+
+// DeleteWebhook removes a subscription and its delivery log. Dead letters
+// are kept.
+func DeleteWebhook(id int64) error {
+	res, err := db.DB.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	} else if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// GetWebhook returns a subscription without its secret.
+func GetWebhook(id int64) (*Webhook, error) {
+	return scanWebhook(db.DB.QueryRow(`SELECT `+webhookColumns+` FROM webhook_subscriptions WHERE id = $1`, id))
+}
+
+// ListWebhooks returns every subscription, oldest first.
+func ListWebhooks() ([]Webhook, error) {
+	rows, err := db.DB.Query(`SELECT ` + webhookColumns + ` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// newWebhook validates a request. A threshold is kept in one currency, the
+// default one unless named.
+func newWebhook(req WebhookRequest) (*Webhook, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+	w := &Webhook{URL: req.URL, UserID: req.UserID, Active: req.Active == nil || *req.Active}
+
+	seen := make(map[string]bool)
+	for _, e := range req.Events {
+		if !webhookEvents[e] {
+			return nil, ErrInvalidWebhookEvent
+		}
+		if !seen[e] {
+			seen[e] = true
+			w.Events = append(w.Events, e)
+		}
+	}
+	if len(w.Events) == 0 {
+		return nil, ErrInvalidWebhookEvent
+	}
+
+	if strings.TrimSpace(req.Threshold) != "" {
+		threshold, err := ParseMoney(req.Threshold)
+		if err == ErrAmountOverflow {
+			return nil, ErrAmountOverflow
+		}
+		if err != nil || threshold < 0 {
+			return nil, ErrInvalidAmount
+		}
+		w.Currency = normalizeCurrency(req.Currency)
+		if err := checkCurrencyAmount(w.Currency, threshold); err != nil {
+			return nil, err
+		}
+		w.Threshold = &threshold
+	} else if seen[EventBalanceThresholdCrossed] {
+		return nil, ErrWebhookThreshold
+	}
+	return w, nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// nullUserID maps 0, meaning every user, to SQL NULL.
+func nullUserID(id uint64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+const webhookColumns = `id, url, events, COALESCE(user_id, 0), threshold, COALESCE(currency, ''), active, created_at, updated_at`
+
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	var w Webhook
+	err := row.Scan(&w.ID, &w.URL, pq.Array(&w.Events), &w.UserID, &w.Threshold, &w.Currency, &w.Active,
+		&w.CreatedAt, &w.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook: %w", err)
+	}
+	w.CreatedAt = w.CreatedAt.UTC()
+	w.UpdatedAt = w.UpdatedAt.UTC()
+	return &w, nil
+}
+
+// WebhookSink turns outbox events into pending deliveries for every active
+// subscription they match. Deliveries are unique per subscription, event and
+// type, so an event the relay publishes twice is only delivered once.
+type WebhookSink struct{}
+
+func (WebhookSink) Publish(ctx context.Context, e Event) error {
+	var change BalanceEvent
+	if err := json.Unmarshal(e.Payload, &change); err != nil {
+		return fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin db tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT `+webhookColumns+` FROM webhook_subscriptions
+		WHERE active AND (user_id IS NULL OR user_id = $1)
+		ORDER BY id`, e.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	var subs []Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		subs = append(subs, *w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	queued := 0
+	for _, w := range subs {
+		for _, eventType := range w.Events {
+			var data interface{} = change
+			if eventType == EventBalanceThresholdCrossed {
+				direction := thresholdCrossing(w, change)
+				if direction == "" {
+					continue
+				}
+				data = ThresholdCrossedEvent{BalanceEvent: change, Threshold: *w.Threshold, Direction: direction}
+			} else if eventType != e.Type {
+				continue
+			}
+
+			body, err := json.Marshal(WebhookPayload{ID: e.ID, Type: eventType, UserID: e.UserID, CreatedAt: e.CreatedAt, Data: data})
+			if err != nil {
+				return fmt.Errorf("failed to encode webhook payload: %w", err)
+			}
+			_, err = tx.Exec(`
+				INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, body)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (webhook_id, event_id, event_type) DO NOTHING`,
+				w.ID, e.ID, eventType, string(body))
+			if err != nil {
+				return fmt.Errorf("failed to queue webhook delivery: %w", err)
+			}
+			queued++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if queued > 0 {
+		select {
+		case webhookWake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// thresholdCrossing reports "above" or "below" when a change moves the
+// balance across the subscription's threshold in its currency, else "".
+func thresholdCrossing(w Webhook, change BalanceEvent) string {
+	if w.Threshold == nil || w.Currency != change.Currency {
+		return ""
+	}
+	wasBelow, isBelow := change.PreviousBalance < *w.Threshold, change.Balance < *w.Threshold
+	switch {
+	case wasBelow && !isBelow:
+		return "above"
+	case !wasBelow && isBelow:
+		return "below"
+	default:
+		return ""
+	}
+}
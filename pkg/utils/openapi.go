@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// errorMessageExtension names the OpenAPI extension holding the message a
+// request is rejected with when a parameter or schema fails validation.
+const errorMessageExtension = "x-error-message"
+
+func init() {
+	// String formats the OpenAPI document uses for the validators above
+	openapi3.DefineStringFormatValidator("amount", openapi3.NewCallbackValidator(func(v string) error {
+		if !IsValidAmountFormat(v) {
+			return errors.New("at most 2 decimal places")
+		}
+		return nil
+	}))
+	openapi3.DefineStringFormatValidator("source-type", openapi3.NewCallbackValidator(func(v string) error {
+		if !IsValidSourceType(v) {
+			return errors.New("must be game, server or payment")
+		}
+		return nil
+	}))
+}
+
+// LoadOpenAPI parses and validates an OpenAPI document.
+func LoadOpenAPI(spec []byte) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenAPI document: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	return doc, nil
+}
+
+// NewOpenAPIValidator returns a middleware rejecting requests that do not
+// match the OpenAPI document with 400 and the message of the first failing
+// parameter or field. Requests for routes the document does not describe
+// are passed through, so the router answers them as before.
+func NewOpenAPIValidator(spec []byte) (func(http.Handler) http.Handler, error) {
+	doc, err := LoadOpenAPI(spec)
+	if err != nil {
+		return nil, err
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to route OpenAPI document: %w", err)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Bodies other than JSON (NDJSON streams) are read as they
+			// arrive, so only the handler validates them
+			opts := &openapi3filter.Options{SkipSettingDefaults: true}
+			if body := route.Operation.RequestBody; body != nil && body.Value != nil {
+				if body.Value.GetMediaType("application/json") == nil {
+					opts.ExcludeRequestBody = true
+				} else if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+					// Handlers have always decoded bodies as JSON whatever
+					// the Content-Type, so clients may leave it out
+					r.Header.Set("Content-Type", "application/json")
+				}
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    opts,
+			}
+			if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+				WriteError(w, http.StatusBadRequest, validationMessage(err))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// validationMessage returns the client-facing message for a validation
+// error: the x-error-message of the failing parameter or schema if it has
+// one, or a message naming the parameter or field otherwise.
+func validationMessage(err error) string {
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		return "Invalid request"
+	}
+	var schemaErr *openapi3.SchemaError
+	isSchemaErr := errors.As(reqErr.Err, &schemaErr)
+
+	if p := reqErr.Parameter; p != nil {
+		if msg := errorMessage(p.Extensions); msg != "" {
+			return msg
+		}
+		if isSchemaErr && schemaErr.Schema != nil {
+			if msg := errorMessage(schemaErr.Schema.Extensions); msg != "" {
+				return msg
+			}
+		}
+		if p.Schema != nil && p.Schema.Value != nil {
+			if msg := errorMessage(p.Schema.Value.Extensions); msg != "" {
+				return msg
+			}
+		}
+		return "Invalid " + p.Name
+	}
+
+	if !isSchemaErr {
+		return "Invalid JSON body"
+	}
+	field := strings.Join(schemaErr.JSONPointer(), ".")
+	if schemaErr.SchemaField == "required" {
+		return field + " is required"
+	}
+	if schemaErr.Schema != nil {
+		if msg := errorMessage(schemaErr.Schema.Extensions); msg != "" {
+			return msg
+		}
+	}
+	if field == "" {
+		return "Invalid JSON body"
+	}
+	return "Invalid " + field + ": " + schemaErr.Reason
+}
+
+func errorMessage(extensions map[string]any) string {
+	msg, _ := extensions[errorMessageExtension].(string)
+	return msg
+}
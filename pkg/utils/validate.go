@@ -2,6 +2,15 @@ package utils
 
 import "strings"
 
+// Client-facing messages for values failing the validators below. The
+// OpenAPI document uses the same ones, so a request is answered alike
+// whether the middleware or a handler rejects it.
+const (
+	InvalidSourceTypeMessage = "Missing or invalid Source-Type header"
+	InvalidStateMessage      = "Invalid state: must be 'win' or 'lose'"
+	InvalidAmountMessage     = "Amount must have at most 2 decimal places"
+)
+
 var allowedSourceTypes = map[string]struct{}{
 	"game":    {},
 	"server":  {},
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestAccountLifecycle(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and open a new account
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	if account.Status != user.StatusActive || len(account.Wallets) != 1 || account.Wallets[0].Balance != "0.00" {
+		t.Errorf("Expected an active account with an empty wallet, got %+v", account)
+	}
+	prefix := fmt.Sprintf("acct_%d_", time.Now().UnixNano())
+	txn := func(state, amount, suffix string) error {
+		_, err := user.ProcessTransaction(id, user.TransactionRequest{State: state, Amount: amount, TransactionID: prefix + suffix}, "payment")
+		return err
+	}
+	if err := txn("win", "10.00", "deposit"); err != nil {
+		t.Fatalf("Deposit failed: %v", err)
+	}
+
+	// Step 2: A suspended account rejects transactions, bonuses and holds
+	if a, err := user.UpdateAccountStatus(id, user.StatusSuspended); err != nil || a.Status != user.StatusSuspended {
+		t.Fatalf("Failed to suspend account: %+v (%v)", a, err)
+	}
+	if err := txn("win", "1.00", "suspended"); err != user.ErrAccountNotActive {
+		t.Errorf("Expected a transaction to be rejected while suspended, got %v", err)
+	}
+	if _, err := user.GrantBonus(id, user.BonusRequest{TransactionID: prefix + "bonus", Amount: "1.00"}); err != user.ErrAccountNotActive {
+		t.Errorf("Expected a bonus to be rejected while suspended, got %v", err)
+	}
+	if _, err := user.AuthorizeReservation(id, user.ReservationRequest{ReservationID: prefix + "hold", Amount: "1.00"}, "game"); err != user.ErrAccountNotActive {
+		t.Errorf("Expected a hold to be rejected while suspended, got %v", err)
+	}
+
+	// Step 3: Reopening makes the account usable again
+	if a, err := user.UpdateAccountStatus(id, user.StatusActive); err != nil || a.Status != user.StatusActive {
+		t.Fatalf("Failed to reopen account: %+v (%v)", a, err)
+	}
+	if err := txn("win", "1.00", "reopened"); err != nil {
+		t.Errorf("Expected a transaction after reopening, got %v", err)
+	}
+
+	// Step 4: An account holding funds cannot be closed
+	if _, err := user.UpdateAccountStatus(id, user.StatusClosed); err != user.ErrAccountHasFunds {
+		t.Errorf("Expected closing a funded account to fail, got %v", err)
+	}
+	if err := txn("lose", "11.00", "withdraw"); err != nil {
+		t.Fatalf("Withdrawal failed: %v", err)
+	}
+
+	// Step 5: Once emptied it closes for good
+	if a, err := user.UpdateAccountStatus(id, user.StatusClosed); err != nil || a.Status != user.StatusClosed {
+		t.Fatalf("Failed to close account: %+v (%v)", a, err)
+	}
+	if err := txn("win", "1.00", "closed"); err != user.ErrAccountNotActive {
+		t.Errorf("Expected a transaction to be rejected once closed, got %v", err)
+	}
+	if _, err := user.UpdateAccountStatus(id, user.StatusActive); err != user.ErrAccountClosed {
+		t.Errorf("Expected a closed account not to reopen, got %v", err)
+	}
+	if a, err := user.GetAccount(id); err != nil || a.Status != user.StatusClosed {
+		t.Errorf("Expected the account to stay closed, got %+v (%v)", a, err)
+	}
+
+	// Step 6: Unknown statuses and accounts are rejected
+	if _, err := user.UpdateAccountStatus(id, "frozen"); err != user.ErrInvalidStatus {
+		t.Errorf("Expected an unknown status to be rejected, got %v", err)
+	}
+	if _, err := user.GetAccount(0); err != user.ErrUserNotFound {
+		t.Errorf("Expected an unknown account to be not found, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestBalanceAuditTrail(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker)
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("audit_%d_", time.Now().UnixNano())
+
+	// Step 2: A deposit, a stake and a reversal of the stake each leave an entry
+	for _, req := range []struct {
+		state, amount, source string
+	}{{"win", "30.00", "payment"}, {"lose", "12.50", "game"}} {
+		_, err := user.ProcessTransaction(id, user.TransactionRequest{
+			State: req.state, Amount: req.amount, TransactionID: prefix + req.state,
+		}, req.source)
+		if err != nil {
+			t.Fatalf("Failed to process %s: %v", req.state, err)
+		}
+	}
+	if _, err := user.ReverseTransaction(id, prefix+"lose"); err != nil {
+		t.Fatalf("Failed to reverse stake: %v", err)
+	}
+
+	// Step 3: The trail lists them newest first with before/after balances
+	entries, next, err := user.ListBalanceAudit(id, user.AuditFilter{})
+	if err != nil {
+		t.Fatalf("Failed to list audit: %v", err)
+	}
+	if len(entries) != 3 || next != "" {
+		t.Fatalf("Expected 3 entries on one page, got %d (next %q)", len(entries), next)
+	}
+	want := []struct {
+		previous, balance user.Money
+		reason, source    string
+	}{
+		{1750, 3000, "reversal", "game"},
+		{3000, 1750, "lose", "game"},
+		{0, 3000, "win", "payment"},
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.PreviousBalance != w.previous || e.NewBalance != w.balance || e.Change != w.balance-w.previous ||
+			e.Reason != w.reason || e.SourceType != w.source || e.Actor != user.ActorAPI || e.TransactionID == "" {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, w, e)
+		}
+	}
+
+	// Step 4: Pages continue from the cursor
+	page, next, err := user.ListBalanceAudit(id, user.AuditFilter{Limit: 2})
+	if err != nil || len(page) != 2 || next == "" {
+		t.Fatalf("Expected a first page of 2 with a cursor, got %d (%v)", len(page), err)
+	}
+	page, next, err = user.ListBalanceAudit(id, user.AuditFilter{Limit: 2, Cursor: next})
+	if err != nil || len(page) != 1 || page[0].ID != entries[2].ID || next != "" {
+		t.Errorf("Expected the oldest entry on the last page, got %+v (%v)", page, err)
+	}
+
+	// Step 5: The table is append-only
+	if _, err := db.DB.Exec(`UPDATE balance_audit SET new_balance = 0 WHERE user_id = $1`, id); err == nil {
+		t.Error("Expected updating the audit trail to fail")
+	}
+	if _, err := db.DB.Exec(`DELETE FROM balance_audit WHERE user_id = $1`, id); err == nil {
+		t.Error("Expected deleting from the audit trail to fail")
+	}
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+// sseMessage is one server-sent event read from a stream.
+type sseMessage struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSSE sends the messages of a stream to a channel until it ends.
+func readSSE(resp *http.Response) <-chan sseMessage {
+	out := make(chan sseMessage)
+	go func() {
+		defer close(out)
+		var msg sseMessage
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if msg.data != "" {
+					out <- msg
+				}
+				msg = sseMessage{}
+			case strings.HasPrefix(line, "id: "):
+				msg.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				msg.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				msg.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return out
+}
+
+func TestBalanceStreamPushesAndResumes(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and listen for notifications
+	db.InitDB()
+	db.RunMigrations()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := user.StartBalanceListener(ctx); err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/user/{userId}/balance/stream", user.HandleBalanceStream)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	url := fmt.Sprintf("%s/user/%d/balance/stream", ts.URL, id)
+	prefix := fmt.Sprintf("sse_%d_", time.Now().UnixNano())
+
+	open := func(lastEventID string) (*http.Response, <-chan sseMessage) {
+		req, _ := http.NewRequest("GET", url, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to open stream: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		return resp, readSSE(resp)
+	}
+	next := func(messages <-chan sseMessage) user.Event {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				t.Fatalf("Stream ended")
+			}
+			var e user.Event
+			if err := json.Unmarshal([]byte(msg.data), &e); err != nil {
+				t.Fatalf("Failed to decode %q: %v", msg.data, err)
+			}
+			if msg.id != strconv.FormatInt(e.ID, 10) || msg.event != e.Type {
+				t.Errorf("Message id/event %s/%s do not match event %d/%s", msg.id, msg.event, e.ID, e.Type)
+			}
+			return e
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Timed out waiting for an event")
+		}
+		return user.Event{}
+	}
+	process := func(state, amount, txID string) {
+		if _, err := user.ProcessTransaction(id, user.TransactionRequest{
+			State: state, Amount: amount, TransactionID: prefix + txID,
+		}, "game"); err != nil {
+			t.Fatalf("Failed to process %s: %v", txID, err)
+		}
+	}
+
+	// Step 2: A committed transaction is pushed with its balance and ID
+	resp, messages := open("")
+	process("win", "10.00", "1")
+	first := next(messages)
+	var payload user.BalanceEvent
+	if err := json.Unmarshal(first.Payload, &payload); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if first.UserID != id || payload.TransactionID != prefix+"1" || payload.Balance != 1000 {
+		t.Errorf("Unexpected event %+v %+v", first, payload)
+	}
+	resp.Body.Close()
+
+	// Step 3: Changes made while disconnected are replayed after Last-Event-ID
+	process("lose", "3.00", "2")
+	process("win", "1.00", "3")
+	resp, messages = open(strconv.FormatInt(first.ID, 10))
+	defer resp.Body.Close()
+	for i, want := range []struct {
+		txID    string
+		balance user.Money
+	}{{"2", 700}, {"3", 800}} {
+		e := next(messages)
+		if err := json.Unmarshal(e.Payload, &payload); err != nil {
+			t.Fatalf("Failed to decode payload: %v", err)
+		}
+		if payload.TransactionID != prefix+want.txID || payload.Balance != want.balance {
+			t.Errorf("Replayed event %d: expected %s at %s, got %+v", i, want.txID, want.balance, payload)
+		}
+	}
+
+	// Step 4: A malformed Last-Event-ID is rejected
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	bad, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to call endpoint: %v", err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad Last-Event-ID, got %d", bad.StatusCode)
+	}
+}
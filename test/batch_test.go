@@ -0,0 +1,64 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestAtomicBatchRollsBack(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and open two empty accounts
+	db.InitDB()
+	db.RunMigrations()
+
+	var ids [2]uint64
+	for i := range ids {
+		account, err := user.CreateAccount()
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+		ids[i] = account.UserID
+	}
+	prefix := fmt.Sprintf("batch_%d_", time.Now().UnixNano())
+	item := func(userID uint64, name, state, amount string) user.BatchItem {
+		return user.BatchItem{UserID: userID, SourceType: "game", TransactionRequest: user.TransactionRequest{
+			State: state, Amount: amount, TransactionID: prefix + name,
+		}}
+	}
+
+	// Step 2: The second user cannot cover the stake, so nothing applies
+	outcomes := user.ProcessBatch([]user.BatchItem{
+		item(ids[0], "a1", "win", "10.00"),
+		item(ids[1], "a2", "lose", "5.00"),
+	}, true)
+	if outcomes[0].Err != user.ErrBatchRolledBack || outcomes[1].Err != user.ErrInsufficientBalance {
+		t.Errorf("Expected rollback caused by insufficient balance, got %v / %v", outcomes[0].Err, outcomes[1].Err)
+	}
+	if balance, err := user.GetUserBalance(ids[0]); err != nil || balance.Balance != 0 {
+		t.Errorf("Expected rolled back win to leave balance at 0.00, got %+v (%v)", balance, err)
+	}
+
+	// Step 3: Best effort applies what it can
+	outcomes = user.ProcessBatch([]user.BatchItem{
+		item(ids[0], "b1", "win", "10.00"),
+		item(ids[1], "b2", "lose", "5.00"),
+	}, false)
+	if outcomes[0].Err != nil || outcomes[1].Err != user.ErrInsufficientBalance {
+		t.Errorf("Expected first item applied and second rejected, got %v / %v", outcomes[0].Err, outcomes[1].Err)
+	}
+
+	// Step 4: Items stay idempotent; the applied win replays inside an atomic batch
+	outcomes = user.ProcessBatch([]user.BatchItem{
+		item(ids[0], "b1", "win", "10.00"),
+		item(ids[1], "c1", "win", "1.00"),
+	}, true)
+	if outcomes[0].Err != nil || !outcomes[0].Result.Replayed || outcomes[1].Err != nil {
+		t.Errorf("Expected replay and commit, got %+v", outcomes)
+	}
+	if balance, err := user.GetUserBalance(ids[0]); err != nil || balance.Balance != 1000 {
+		t.Errorf("Expected balance 10.00 after replay, got %+v (%v)", balance, err)
+	}
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestBonusWageringConvertsToCash(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker); runs with the default cash_first order
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("bonus_%d_", time.Now().UnixNano())
+
+	apply := func(name, state, amount, sourceType string) error {
+		_, err := user.ProcessTransaction(id, user.TransactionRequest{
+			State: state, Amount: amount, TransactionID: prefix + name,
+		}, sourceType)
+		return err
+	}
+	mustApply := func(name, state, amount, sourceType string) {
+		if err := apply(name, state, amount, sourceType); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	// Step 2: 10.00 cash, then a 20.00 bonus that needs 30.00 of stakes
+	mustApply("deposit", "win", "10.00", "payment")
+	_, err = user.GrantBonus(id, user.BonusRequest{TransactionID: prefix + "grant", Amount: "20.00", WageringRequirement: "30.00"})
+	if err != nil {
+		t.Fatalf("Failed to grant bonus: %v", err)
+	}
+
+	// Step 3: A 15.00 stake spends the cash first, then 5.00 of bonus
+	mustApply("stake1", "lose", "15.00", "game")
+	txn, err := user.GetTransaction(id, prefix+"stake1")
+	if err != nil {
+		t.Fatalf("Failed to fetch stake: %v", err)
+	}
+	if txn.CashAmount == nil || *txn.CashAmount != 1000 || txn.BonusAmount == nil || *txn.BonusAmount != 500 {
+		t.Errorf("Expected split cash=10.00 bonus=5.00, got %v / %v", txn.CashAmount, txn.BonusAmount)
+	}
+
+	// Step 4: Bonus funds cannot be withdrawn
+	if err := apply("withdraw1", "lose", "1.00", "payment"); err != user.ErrInsufficientCash {
+		t.Errorf("Expected withdrawal of bonus funds to fail, got %v", err)
+	}
+
+	// Step 5: Winnings while wagering are bonus; completing the requirement converts them
+	mustApply("payout", "win", "10.00", "game")
+	mustApply("stake2", "lose", "15.00", "game")
+
+	wallets, err := user.ListWallets(id, "")
+	if err != nil || len(wallets) != 1 {
+		t.Fatalf("Failed to fetch wallet: %v", err)
+	}
+	w := wallets[0]
+	if w.Balance != 1000 || w.Bonus != 0 || w.Cash() != 1000 || w.WageringRequired != 0 {
+		t.Errorf("Expected 10.00 converted to cash, got balance=%s bonus=%s wagering=%s",
+			w.Balance, w.Bonus, w.WageringRequired)
+	}
+	mustApply("withdraw2", "lose", "10.00", "payment")
+}
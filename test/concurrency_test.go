@@ -0,0 +1,131 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestConcurrentDuplicateTransactionAppliesOnce(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker)
+	db.InitDB()
+	db.RunMigrations()
+
+	const (
+		userID  = 2
+		workers = 20
+	)
+
+	before, err := user.GetUserBalance(userID)
+	if err != nil {
+		t.Fatalf("Failed to fetch initial balance: %v", err)
+	}
+
+	// Step 2: Fire the same transaction ID from many goroutines at once
+	req := user.TransactionRequest{
+		State:         "win",
+		Amount:        "1.25",
+		TransactionID: fmt.Sprintf("race_txn_%d", time.Now().UnixNano()),
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		applied  int
+		replayed int
+		failures []error
+	)
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			result, err := user.ProcessTransaction(userID, req, "game")
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				failures = append(failures, err)
+			case result.Replayed:
+				replayed++
+			default:
+				applied++
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	// Step 3: Exactly one request applies, the rest are replays
+	if len(failures) > 0 {
+		t.Fatalf("Expected no errors, got %v", failures)
+	}
+	if applied != 1 || replayed != workers-1 {
+		t.Fatalf("Expected 1 applied and %d replayed, got %d and %d", workers-1, applied, replayed)
+	}
+
+	// Step 4: The balance moved exactly once
+	after, err := user.GetUserBalance(userID)
+	if err != nil {
+		t.Fatalf("Failed to fetch final balance: %v", err)
+	}
+	if diff := after.Balance - before.Balance; diff != 125 {
+		t.Errorf("Expected balance to change by 1.25 once, got %s", diff)
+	}
+}
+
+func TestConcurrentDuplicateRoundStakeAppliesOnce(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and fund a new account
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("race_round_%d_", time.Now().UnixNano())
+	_, err = user.ProcessTransaction(id, user.TransactionRequest{State: "win", Amount: "10.00", TransactionID: prefix + "fund"}, "payment")
+	if err != nil {
+		t.Fatalf("Failed to fund account: %v", err)
+	}
+
+	// Step 2: Fire the same stake into a new round from many goroutines at once
+	req := user.TransactionRequest{State: "lose", Amount: "2.00", TransactionID: prefix + "stake", RoundID: prefix + "r1"}
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	start := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := user.ProcessTransaction(id, req, "game")
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Expected apply or replay, got %v", err)
+		}
+	}
+
+	// Step 3: Only the claiming request touched the round and the wallet
+	round, err := user.GetRound(id, req.RoundID)
+	if err != nil || round.Stake != 200 || round.Status != user.RoundOpen {
+		t.Errorf("Expected an open round with stake 2.00, got %+v (%v)", round, err)
+	}
+	balance, err := user.GetUserBalance(id)
+	if err != nil || balance.Balance != 800 {
+		t.Errorf("Expected balance 8.00, got %+v (%v)", balance, err)
+	}
+}
@@ -0,0 +1,115 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestTimeOutBlocksGameStakes(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker)
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("excl_%d_", time.Now().UnixNano())
+
+	apply := func(req user.TransactionRequest, sourceType string) error {
+		req.TransactionID = prefix + req.TransactionID
+		_, err := user.ProcessTransaction(id, req, sourceType)
+		return err
+	}
+
+	// Step 2: Fund the account and open a round before the time-out
+	if err := apply(user.TransactionRequest{State: "win", Amount: "20.00", TransactionID: "deposit"}, "payment"); err != nil {
+		t.Fatalf("Deposit failed: %v", err)
+	}
+	if err := apply(user.TransactionRequest{State: "lose", Amount: "2.00", TransactionID: "bet", RoundID: prefix + "r1"}, "game"); err != nil {
+		t.Fatalf("Stake failed: %v", err)
+	}
+
+	// A time-out records the actor that applied it
+	if _, err := user.CreateExclusion(id, user.ExclusionRequest{Type: user.ExclusionTimeOut, DurationSeconds: 3600}); err != user.ErrInvalidExclusion {
+		t.Errorf("Expected a time-out without an actor to be rejected, got %v", err)
+	}
+	_, err = user.CreateExclusion(id, user.ExclusionRequest{Type: user.ExclusionTimeOut, DurationSeconds: 3600, Reason: "test", Actor: "support:test"})
+	if err != nil {
+		t.Fatalf("Failed to create time-out: %v", err)
+	}
+
+	// Step 3: New stakes are rejected
+	if err := apply(user.TransactionRequest{State: "lose", Amount: "1.00", TransactionID: "blocked"}, "game"); err != user.ErrExcluded {
+		t.Errorf("Expected stake to be rejected during time-out, got %v", err)
+	}
+
+	// Step 4: The open round still settles, and withdrawals still work
+	if err := apply(user.TransactionRequest{State: "win", Amount: "3.00", TransactionID: "payout", RoundID: prefix + "r1"}, "game"); err != nil {
+		t.Errorf("Expected open round to settle, got %v", err)
+	}
+	if err := apply(user.TransactionRequest{State: "lose", Amount: "5.00", TransactionID: "withdraw"}, "payment"); err != nil {
+		t.Errorf("Expected withdrawal to go through, got %v", err)
+	}
+
+	// Step 5: The time-out is in the history and active
+	history, err := user.ListExclusions(id)
+	if err != nil || len(history) != 1 || !history[0].Active || history[0].EndsAt == nil || history[0].Actor != "support:test" {
+		t.Errorf("Expected one active time-out by support:test in history, got %+v (%v)", history, err)
+	}
+}
+
+func TestExclusionOnlySettlesRoundsOpenedBefore(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker)
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("excl_round_%d_", time.Now().UnixNano())
+
+	apply := func(req user.TransactionRequest, sourceType string) error {
+		req.TransactionID = prefix + req.TransactionID
+		_, err := user.ProcessTransaction(id, req, sourceType)
+		return err
+	}
+
+	// Step 2: Fund the account, open a round, then self-exclude
+	if err := apply(user.TransactionRequest{State: "win", Amount: "20.00", TransactionID: "deposit"}, "payment"); err != nil {
+		t.Fatalf("Deposit failed: %v", err)
+	}
+	if err := apply(user.TransactionRequest{State: "lose", Amount: "2.00", TransactionID: "before", RoundID: prefix + "before"}, "game"); err != nil {
+		t.Fatalf("Stake failed: %v", err)
+	}
+	e, err := user.CreateExclusion(id, user.ExclusionRequest{Type: user.ExclusionSelf, DurationSeconds: 3600})
+	if err != nil || e.Actor != user.ActorAPI {
+		t.Fatalf("Failed to self-exclude: %+v (%v)", e, err)
+	}
+
+	// Step 3: A round opened since, by a stake the exclusion does not cover, cannot be closed by a game stake
+	if err := apply(user.TransactionRequest{State: "lose", Amount: "1.00", TransactionID: "after", RoundID: prefix + "after"}, "server"); err != nil {
+		t.Fatalf("Server stake failed: %v", err)
+	}
+	err = apply(user.TransactionRequest{State: "lose", Amount: "1.00", TransactionID: "close_after", RoundID: prefix + "after", EndRound: true}, "game")
+	if err != user.ErrExcluded {
+		t.Errorf("Expected closing a round opened during the exclusion to be rejected, got %v", err)
+	}
+
+	// Step 4: The round opened before the exclusion still closes
+	err = apply(user.TransactionRequest{State: "lose", Amount: "1.00", TransactionID: "close_before", RoundID: prefix + "before", EndRound: true}, "game")
+	if err != nil {
+		t.Errorf("Expected the earlier round to close, got %v", err)
+	}
+	round, err := user.GetRound(id, prefix+"before")
+	if err != nil || round.Status != user.RoundSettled || round.Stake != 300 {
+		t.Errorf("Expected a settled round with stake 3.00, got %+v (%v)", round, err)
+	}
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	walletv1 "entain-app/api/wallet/v1"
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestGRPCWalletService(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker)
+	db.InitDB()
+	db.RunMigrations()
+
+	// Step 2: Serve in-process over bufconn
+	lis := bufconn.Listen(1 << 20)
+	srv := user.NewGRPCServer()
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	client := walletv1.NewWalletServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	txID := fmt.Sprintf("grpc_%d", time.Now().UnixNano())
+
+	// Step 3: Health and reflection are served next to the wallet service
+	health, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "entain.wallet.v1.WalletService"})
+	if err != nil || health.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Expected SERVING, got %v (%v)", health, err)
+	}
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open reflection stream: %v", err)
+	}
+	stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	listed, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Failed to list services: %v", err)
+	}
+	found := false
+	for _, s := range listed.GetListServicesResponse().GetService() {
+		found = found || s.Name == "entain.wallet.v1.WalletService"
+	}
+	if !found {
+		t.Errorf("Reflection does not list the wallet service")
+	}
+
+	// Step 4: Process a transaction, then replay it
+	req := &walletv1.ProcessTransactionRequest{
+		UserId: id, SourceType: "game", State: "win", Amount: "10.15", TransactionId: txID,
+	}
+	resp, err := client.ProcessTransaction(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to process transaction: %v", err)
+	}
+	if resp.Balance != "10.15" || resp.Replayed {
+		t.Errorf("Unexpected response %v", resp)
+	}
+	resp, err = client.ProcessTransaction(ctx, req)
+	if err != nil || !resp.Replayed {
+		t.Errorf("Expected a replay, got %v (%v)", resp, err)
+	}
+
+	// Step 5: Errors map like the HTTP endpoint's
+	for _, tc := range []struct {
+		req  *walletv1.ProcessTransactionRequest
+		code codes.Code
+		msg  string
+	}{
+		{&walletv1.ProcessTransactionRequest{UserId: id, SourceType: "game", State: "draw", Amount: "1.00", TransactionId: txID + "_a"},
+			codes.InvalidArgument, "Invalid state: must be 'win' or 'lose'"},
+		{&walletv1.ProcessTransactionRequest{UserId: id, SourceType: "casino", State: "win", Amount: "1.00", TransactionId: txID + "_b"},
+			codes.InvalidArgument, "Missing or invalid source type"},
+		{&walletv1.ProcessTransactionRequest{UserId: id, SourceType: "game", State: "lose", Amount: "100.00", TransactionId: txID + "_c"},
+			codes.InvalidArgument, user.ErrInsufficientBalance.Error()},
+		{&walletv1.ProcessTransactionRequest{UserId: id, SourceType: "game", State: "lose", Amount: "10.15", TransactionId: txID},
+			codes.Aborted, ""},
+	} {
+		_, err := client.ProcessTransaction(ctx, tc.req)
+		st := status.Convert(err)
+		if st.Code() != tc.code || (tc.msg != "" && st.Message() != tc.msg) {
+			t.Errorf("%s: expected %s %q, got %s %q", tc.req.TransactionId, tc.code, tc.msg, st.Code(), st.Message())
+		}
+	}
+
+	// Step 6: Balance and transaction lookup
+	balance, err := client.GetBalance(ctx, &walletv1.GetBalanceRequest{UserId: id})
+	if err != nil {
+		t.Fatalf("Failed to get balance: %v", err)
+	}
+	if balance.Balance != "10.15" || len(balance.Wallets) == 0 {
+		t.Errorf("Unexpected balance %v", balance)
+	}
+	txn, err := client.GetTransaction(ctx, &walletv1.GetTransactionRequest{UserId: id, TransactionId: txID})
+	if err != nil {
+		t.Fatalf("Failed to get transaction: %v", err)
+	}
+	if txn.Amount != "10.15" || txn.State != "win" || txn.BalanceAfter != "10.15" {
+		t.Errorf("Unexpected transaction %v", txn)
+	}
+	_, err = client.GetTransaction(ctx, &walletv1.GetTransactionRequest{UserId: id, TransactionId: txID + "_missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+}
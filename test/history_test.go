@@ -0,0 +1,107 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestTransactionHistoryPagination(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and post more transactions than a page can hold
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("hist_%d_", time.Now().UnixNano())
+
+	const total = user.MaxHistoryLimit + 5
+	items := make([]user.BatchItem, total)
+	for i := range items {
+		items[i] = user.BatchItem{UserID: id, SourceType: "payment", TransactionRequest: user.TransactionRequest{
+			State: "win", Amount: "1.00", TransactionID: fmt.Sprintf("%s%03d", prefix, i),
+		}}
+	}
+	for _, outcome := range user.ProcessBatch(items, true) {
+		if outcome.Err != nil {
+			t.Fatalf("Failed to post transactions: %v", outcome.Err)
+		}
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/user/{userId}/transactions", user.HandleTransactionHistory)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	get := func(query string) (int, user.TransactionHistoryResponse, string) {
+		resp, err := http.Get(fmt.Sprintf("%s/user/%d/transactions?%s", ts.URL, id, query))
+		if err != nil {
+			t.Fatalf("Failed to call endpoint: %v", err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			user.TransactionHistoryResponse
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.TransactionHistoryResponse, body.Error
+	}
+
+	// Step 2: Following nextCursor visits every transaction once, newest first
+	seen := make(map[string]bool)
+	var last string
+	cursor, pages := "", 0
+	for {
+		status, page, _ := get("limit=60&cursor=" + cursor)
+		if status != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", status)
+		}
+		pages++
+		for _, txn := range page.Transactions {
+			if seen[txn.TransactionID] {
+				t.Errorf("Transaction %s returned twice", txn.TransactionID)
+			}
+			if last != "" && txn.TransactionID > last {
+				t.Errorf("Expected newest first, got %s after %s", txn.TransactionID, last)
+			}
+			seen[txn.TransactionID], last = true, txn.TransactionID
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(seen) != total || pages != 4 {
+		t.Errorf("Expected %d transactions over 4 pages, got %d over %d", total, len(seen), pages)
+	}
+
+	// Step 3: The limit defaults to DefaultHistoryLimit and is capped at MaxHistoryLimit
+	if _, page, _ := get(""); len(page.Transactions) != user.DefaultHistoryLimit || page.NextCursor == "" {
+		t.Errorf("Expected a default page of %d with a cursor, got %d", user.DefaultHistoryLimit, len(page.Transactions))
+	}
+	if _, page, _ := get("limit=100000"); len(page.Transactions) != user.MaxHistoryLimit || page.NextCursor == "" {
+		t.Errorf("Expected the page to be capped at %d, got %d", user.MaxHistoryLimit, len(page.Transactions))
+	}
+
+	// Step 4: A malformed cursor or limit is rejected
+	for query, want := range map[string]string{
+		"cursor=not-a-cursor": "Invalid cursor",
+		"limit=0":             "Invalid limit",
+		"limit=ten":           "Invalid limit",
+	} {
+		if status, _, msg := get(query); status != http.StatusBadRequest || msg != want {
+			t.Errorf("%s: expected 400 %q, got %d %q", query, want, status, msg)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestTransactionReplayAndConflict(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and serve the transaction endpoints
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	txID := fmt.Sprintf("idem_%d", time.Now().UnixNano())
+
+	router := mux.NewRouter()
+	router.HandleFunc("/user/{userId}/transaction", user.HandleTransaction).Methods("POST")
+	router.HandleFunc("/user/{userId}/transaction/{transactionId}", user.HandleGetTransaction).Methods("GET")
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	post := func(state, amount string) (*http.Response, map[string]interface{}) {
+		body, _ := json.Marshal(map[string]string{"state": state, "amount": amount, "transactionId": txID})
+		req, _ := http.NewRequest("POST", fmt.Sprintf("%s/user/%d/transaction", ts.URL, id), bytes.NewBuffer(body))
+		req.Header.Set("Source-Type", "payment")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to call endpoint: %v", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp, result
+	}
+
+	// Step 2: The first request applies
+	resp, first := post("win", "12.50")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Fatalf("Expected a fresh 200, got %d %v", resp.StatusCode, first)
+	}
+
+	// Step 3: The same ID and body replays the original response without applying again
+	resp, replay := post("win", "12.50")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected a replayed 200, got %d %v", resp.StatusCode, replay)
+	}
+	if replay["balance"] != first["balance"] {
+		t.Errorf("Expected replay balance %v, got %v", first["balance"], replay["balance"])
+	}
+	balance, err := user.GetUserBalance(id)
+	if err != nil || balance.Balance != 1250 {
+		t.Errorf("Expected balance 12.50 after replay, got %+v (%v)", balance, err)
+	}
+
+	// Step 4: The same ID with a different body conflicts and names what differs
+	resp, conflict := post("lose", "12.50")
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("Expected 409, got %d %v", resp.StatusCode, conflict)
+	}
+	mismatches, _ := conflict["mismatches"].([]interface{})
+	if len(mismatches) != 1 || mismatches[0].(map[string]interface{})["field"] != "state" {
+		t.Errorf("Expected a single state mismatch, got %v", conflict["mismatches"])
+	}
+
+	// Step 5: The lookup returns the stored outcome; unknown IDs are 404
+	resp, err = http.Get(fmt.Sprintf("%s/user/%d/transaction/%s", ts.URL, id, txID))
+	if err != nil {
+		t.Fatalf("Failed to call endpoint: %v", err)
+	}
+	var stored user.Transaction
+	json.NewDecoder(resp.Body).Decode(&stored)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || stored.State != "win" || stored.BalanceAfter == nil || *stored.BalanceAfter != 1250 {
+		t.Errorf("Expected the stored win with balance after 12.50, got %d %+v", resp.StatusCode, stored)
+	}
+	resp, err = http.Get(fmt.Sprintf("%s/user/%d/transaction/%s_missing", ts.URL, id, txID))
+	if err != nil {
+		t.Fatalf("Failed to call endpoint: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown transaction, got %d", resp.StatusCode)
+	}
+}
+
+func TestReplayBypassesAccountGates(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and apply a deposit and a stake
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("gates_%d_", time.Now().UnixNano())
+	deposit := user.TransactionRequest{State: "win", Amount: "20.00", TransactionID: prefix + "deposit"}
+	stake := user.TransactionRequest{State: "lose", Amount: "2.00", TransactionID: prefix + "stake"}
+
+	if _, err := user.ProcessTransaction(id, deposit, "payment"); err != nil {
+		t.Fatalf("Deposit failed: %v", err)
+	}
+	if _, err := user.ProcessTransaction(id, stake, "game"); err != nil {
+		t.Fatalf("Stake failed: %v", err)
+	}
+
+	// Step 2: Once suspended, a retry still replays but a new transaction is rejected
+	if _, err := user.UpdateAccountStatus(id, user.StatusSuspended); err != nil {
+		t.Fatalf("Failed to suspend account: %v", err)
+	}
+	result, err := user.ProcessTransaction(id, deposit, "payment")
+	if err != nil || !result.Replayed || result.Balance == nil || *result.Balance != 2000 {
+		t.Errorf("Expected replay with balance 20.00 while suspended, got %+v (%v)", result, err)
+	}
+	_, err = user.ProcessTransaction(id, user.TransactionRequest{State: "win", Amount: "1.00", TransactionID: prefix + "new"}, "payment")
+	if err != user.ErrAccountNotActive {
+		t.Errorf("Expected a new transaction to be rejected while suspended, got %v", err)
+	}
+
+	// Step 3: Once excluded, a retried stake still replays but a new stake is rejected
+	if _, err := user.UpdateAccountStatus(id, user.StatusActive); err != nil {
+		t.Fatalf("Failed to reactivate account: %v", err)
+	}
+	if _, err := user.CreateExclusion(id, user.ExclusionRequest{Type: user.ExclusionSelf, DurationSeconds: 3600}); err != nil {
+		t.Fatalf("Failed to create exclusion: %v", err)
+	}
+	result, err = user.ProcessTransaction(id, stake, "game")
+	if err != nil || !result.Replayed {
+		t.Errorf("Expected stake replay while excluded, got %+v (%v)", result, err)
+	}
+	_, err = user.ProcessTransaction(id, user.TransactionRequest{State: "lose", Amount: "1.00", TransactionID: prefix + "stake2"}, "game")
+	if err != user.ErrExcluded {
+		t.Errorf("Expected a new stake to be rejected while excluded, got %v", err)
+	}
+
+	// Step 4: Changing a retried body still conflicts rather than hitting a gate
+	_, err = user.ProcessTransaction(id, user.TransactionRequest{State: "lose", Amount: "3.00", TransactionID: prefix + "stake"}, "game")
+	if !errors.Is(err, user.ErrTransactionConflict) {
+		t.Errorf("Expected a conflict for a changed retry, got %v", err)
+	}
+}
+
+func TestChangedEndRoundConflicts(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and fund a new account
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("end_round_%d_", time.Now().UnixNano())
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{State: "win", Amount: "10.00", TransactionID: prefix + "fund"}, "payment"); err != nil {
+		t.Fatalf("Failed to fund account: %v", err)
+	}
+
+	// Step 2: Stake into a round without closing it
+	stake := user.TransactionRequest{State: "lose", Amount: "2.00", TransactionID: prefix + "stake", RoundID: prefix + "r1"}
+	if _, err := user.ProcessTransaction(id, stake, "game"); err != nil {
+		t.Fatalf("Stake failed: %v", err)
+	}
+
+	// Step 3: Retrying it as the closing stake is a conflict on endRound, not a replay
+	closing := stake
+	closing.EndRound = true
+	_, err = user.ProcessTransaction(id, closing, "game")
+	var conflict *user.ConflictError
+	if !errors.As(err, &conflict) || len(conflict.Mismatches) != 1 || conflict.Mismatches[0].Field != "endRound" {
+		t.Fatalf("Expected a single endRound mismatch, got %v", err)
+	}
+
+	// Step 4: The exact retry still replays, and the round stays open
+	if result, err := user.ProcessTransaction(id, stake, "game"); err != nil || !result.Replayed {
+		t.Errorf("Expected the stake to replay, got %+v (%v)", result, err)
+	}
+	round, err := user.GetRound(id, stake.RoundID)
+	if err != nil || round.Status != user.RoundOpen {
+		t.Errorf("Expected the round to stay open, got %+v (%v)", round, err)
+	}
+}
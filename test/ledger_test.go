@@ -0,0 +1,164 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestJournalEntriesBalanceAndRebuildBalances(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker)
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("ledger_%d_", time.Now().UnixNano())
+
+	// Step 2: Post one transaction of every kind
+	for _, tc := range []struct {
+		state, amount, id, sourceType string
+	}{
+		{"win", "50.00", "deposit", "payment"},
+		{"lose", "7.25", "bet", "game"},
+		{"win", "3.10", "payout", "game"},
+		{"win", "1.00", "adjust", "server"},
+		{"lose", "10.00", "withdraw", "payment"},
+	} {
+		_, err := user.ProcessTransaction(id, user.TransactionRequest{
+			State: tc.state, Amount: tc.amount, TransactionID: prefix + tc.id,
+		}, tc.sourceType)
+		if err != nil {
+			t.Fatalf("Transaction %s failed: %v", tc.id, err)
+		}
+	}
+	if _, err := user.GrantBonus(id, user.BonusRequest{TransactionID: prefix + "bonus", Amount: "5.00"}); err != nil {
+		t.Fatalf("Bonus failed: %v", err)
+	}
+	if _, err := user.ReverseTransaction(id, prefix+"bet"); err != nil {
+		t.Fatalf("Reversal failed: %v", err)
+	}
+
+	// Step 3: Each transaction has exactly one entry, and every entry balances
+	var entries, unbalanced int
+	err = db.DB.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE net <> 0) FROM (
+			SELECT e.id, SUM(CASE p.direction WHEN 'debit' THEN p.amount ELSE -p.amount END) AS net
+			FROM journal_entries e JOIN postings p ON p.entry_id = e.id
+			JOIN transactions t ON t.transaction_id = e.transaction_id
+			WHERE t.user_id = $1
+			GROUP BY e.id) entries`, id).Scan(&entries, &unbalanced)
+	if err != nil {
+		t.Fatalf("Failed to sum postings: %v", err)
+	}
+	if entries != 7 || unbalanced != 0 {
+		t.Errorf("Expected 7 balanced entries, got %d with %d unbalanced", entries, unbalanced)
+	}
+
+	// Step 4: Rebuilding from postings reproduces the wallet balance
+	before, err := user.GetUserBalance(id)
+	if err != nil {
+		t.Fatalf("Failed to fetch balance: %v", err)
+	}
+	if before.Balance != 4910 { // 50.00 - 7.25 + 3.10 + 1.00 - 10.00 + 5.00 + 7.25
+		t.Errorf("Expected balance 49.10, got %s", before.Balance)
+	}
+	rebuilt, err := user.RebuildBalance(id, user.DefaultCurrency())
+	if err != nil || rebuilt != before.Balance {
+		t.Errorf("Expected rebuild to reproduce %s, got %s (%v)", before.Balance, rebuilt, err)
+	}
+
+	// Step 5: A drifted projection is restored from the ledger
+	if _, err := db.DB.Exec(`UPDATE wallets SET balance = balance + 100 WHERE user_id = $1`, id); err != nil {
+		t.Fatalf("Failed to corrupt balance: %v", err)
+	}
+	rebuilt, err = user.RebuildBalance(id, user.DefaultCurrency())
+	if err != nil || rebuilt != before.Balance {
+		t.Errorf("Expected rebuild to restore %s, got %s (%v)", before.Balance, rebuilt, err)
+	}
+	after, err := user.GetUserBalance(id)
+	if err != nil || after.Balance != before.Balance {
+		t.Errorf("Expected balance %s after rebuild, got %+v (%v)", before.Balance, after, err)
+	}
+}
+
+func TestUnbalancedJournalEntryIsRejected(t *testing.T) {
+	posting := func(code string, d user.Direction, amount user.Money) user.Posting {
+		return user.Posting{AccountCode: code, Currency: "EUR", Direction: d, Amount: amount}
+	}
+
+	tests := []struct {
+		name     string
+		postings []user.Posting
+		valid    bool
+	}{
+		{"balanced", []user.Posting{posting("a", user.Debit, 100), posting("b", user.Credit, 100)}, true},
+		{"split credit", []user.Posting{posting("a", user.Debit, 100), posting("b", user.Credit, 60), posting("c", user.Credit, 40)}, true},
+		{"unbalanced", []user.Posting{posting("a", user.Debit, 100), posting("b", user.Credit, 99)}, false},
+		{"single leg", []user.Posting{posting("a", user.Debit, 100)}, false},
+		{"zero amount", []user.Posting{posting("a", user.Debit, 0), posting("b", user.Credit, 0)}, false},
+		{"mixed currency", []user.Posting{posting("a", user.Debit, 100), {AccountCode: "b", Currency: "USD", Direction: user.Credit, Amount: 100}}, false},
+	}
+	for _, tc := range tests {
+		err := user.JournalEntry{Postings: tc.postings}.Validate()
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tc.name, tc.valid, err)
+		}
+	}
+}
+
+func TestRebuildKeepsBonusWithinBalance(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and grant a wagered bonus
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	txID := fmt.Sprintf("ledger_bonus_%d", time.Now().UnixNano())
+	if _, err := user.GrantBonus(id, user.BonusRequest{TransactionID: txID, Amount: "5.00", WageringRequirement: "50.00"}); err != nil {
+		t.Fatalf("Bonus failed: %v", err)
+	}
+
+	// Step 2: Drift the projection so it holds more bonus than the ledger backs
+	if _, err := db.DB.Exec(`UPDATE wallets SET balance = balance + 1000, bonus = bonus + 1000 WHERE user_id = $1`, id); err != nil {
+		t.Fatalf("Failed to corrupt balance: %v", err)
+	}
+
+	// Step 3: The rebuild restores the balance and cuts the bonus to it, so cash is never negative
+	rebuilt, err := user.RebuildBalance(id, user.DefaultCurrency())
+	if err != nil || rebuilt != 500 {
+		t.Fatalf("Expected rebuild to give 5.00, got %s (%v)", rebuilt, err)
+	}
+	wallets, err := user.ListWallets(id, user.DefaultCurrency())
+	if err != nil {
+		t.Fatalf("Failed to fetch wallet: %v", err)
+	}
+	w := wallets[0]
+	if w.Balance != 500 || w.Bonus != 500 || w.Cash() != 0 || w.WageringRequired != 5000 {
+		t.Errorf("Expected balance and bonus 5.00 with wagering 50.00 kept, got %+v", w)
+	}
+
+	// Step 4: A ledger that no longer backs the bonus at all drops it and its wagering
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{State: "lose", Amount: "5.00", TransactionID: txID + "_spent"}, "game"); err != nil {
+		t.Fatalf("Stake failed: %v", err)
+	}
+	if _, err := db.DB.Exec(`UPDATE wallets SET bonus = 300, balance = 300 WHERE user_id = $1`, id); err != nil {
+		t.Fatalf("Failed to corrupt balance: %v", err)
+	}
+	if rebuilt, err := user.RebuildBalance(id, user.DefaultCurrency()); err != nil || rebuilt != 0 {
+		t.Fatalf("Expected rebuild to give 0.00, got %s (%v)", rebuilt, err)
+	}
+	wallets, err = user.ListWallets(id, user.DefaultCurrency())
+	if err != nil || wallets[0].Bonus != 0 || wallets[0].WageringRequired != 0 || wallets[0].WageringProgress != 0 {
+		t.Errorf("Expected the bonus and its wagering to be dropped, got %+v (%v)", wallets, err)
+	}
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestDepositLimitCoolingOff(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker); runs with the default 24h cooling-off
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("limit_%d_", time.Now().UnixNano())
+
+	deposit := func(name, amount string) error {
+		_, err := user.ProcessTransaction(id, user.TransactionRequest{
+			State: "win", Amount: amount, TransactionID: prefix + name,
+		}, "payment")
+		return err
+	}
+	setLimit := func(amount string) *user.Limit {
+		limit, err := user.SetLimit(id, user.LimitRequest{Type: user.LimitDeposit, Period: user.PeriodDaily, Amount: amount})
+		if err != nil {
+			t.Fatalf("Failed to set limit to %s: %v", amount, err)
+		}
+		return limit
+	}
+
+	// Step 2: A 50.00 daily deposit limit lets 30.00 through but not another 30.00
+	setLimit("50.00")
+	if err := deposit("d1", "30.00"); err != nil {
+		t.Fatalf("Deposit within limit failed: %v", err)
+	}
+	var exceeded *user.LimitExceededError
+	if err := deposit("d2", "30.00"); !errors.As(err, &exceeded) || exceeded.Used != 3000 {
+		t.Fatalf("Expected daily deposit limit to be exceeded with 30.00 used, got %v", err)
+	}
+
+	// Step 3: Raising the limit waits for the cooling-off period
+	limit := setLimit("100.00")
+	if limit.Amount != 5000 || limit.PendingAmount == nil || *limit.PendingAmount != 10000 || limit.PendingEffectiveAt == nil {
+		t.Errorf("Expected 100.00 pending over 50.00, got %+v", limit)
+	}
+	if err := deposit("d3", "30.00"); !errors.Is(err, user.ErrLimitExceeded) {
+		t.Errorf("Expected raised limit not to apply yet, got %v", err)
+	}
+
+	// Step 4: Lowering it applies at once and drops the pending raise
+	limit = setLimit("40.00")
+	if limit.Amount != 4000 || limit.PendingAmount != nil {
+		t.Errorf("Expected 40.00 with nothing pending, got %+v", limit)
+	}
+	if err := deposit("d4", "10.00"); err != nil {
+		t.Errorf("Deposit up to the lowered limit failed: %v", err)
+	}
+	if err := deposit("d5", "0.01"); !errors.Is(err, user.ErrLimitExceeded) {
+		t.Errorf("Expected lowered limit to be enforced, got %v", err)
+	}
+}
+
+func TestGameHoldsCountTowardsWagerLimits(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker), fund a new account and set a 10.00 daily wager limit
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("holdlimit_%d_", time.Now().UnixNano())
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{State: "win", Amount: "50.00", TransactionID: prefix + "fund"}, "payment"); err != nil {
+		t.Fatalf("Failed to fund account: %v", err)
+	}
+	if _, err := user.SetLimit(id, user.LimitRequest{Type: user.LimitWager, Period: user.PeriodDaily, Amount: "10.00"}); err != nil {
+		t.Fatalf("Failed to set limit: %v", err)
+	}
+	stake := func(name, amount string) error {
+		_, err := user.ProcessTransaction(id, user.TransactionRequest{State: "lose", Amount: amount, TransactionID: prefix + name}, "game")
+		return err
+	}
+
+	// Step 2: A hold over the limit is rejected at authorize
+	var exceeded *user.LimitExceededError
+	_, err = user.AuthorizeReservation(id, user.ReservationRequest{ReservationID: prefix + "big", Amount: "11.00"}, "game")
+	if !errors.As(err, &exceeded) || exceeded.Type != user.LimitWager {
+		t.Errorf("Expected a hold over the wager limit to be rejected, got %v", err)
+	}
+
+	// Step 3: A 6.00 hold leaves 4.00 of headroom for stakes and other holds
+	hold := prefix + "hold"
+	if _, err := user.AuthorizeReservation(id, user.ReservationRequest{ReservationID: hold, Amount: "6.00"}, "game"); err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	if err := stake("s1", "5.00"); !errors.As(err, &exceeded) || exceeded.Used != 600 {
+		t.Errorf("Expected a stake past the held amount to be rejected with 6.00 used, got %v", err)
+	}
+	_, err = user.AuthorizeReservation(id, user.ReservationRequest{ReservationID: prefix + "hold2", Amount: "5.00"}, "game")
+	if !errors.Is(err, user.ErrLimitExceeded) {
+		t.Errorf("Expected a second hold past the limit to be rejected, got %v", err)
+	}
+	if err := stake("s2", "4.00"); err != nil {
+		t.Fatalf("Stake within the headroom failed: %v", err)
+	}
+
+	// Step 4: The hold is not counted twice when it is captured
+	if _, err := user.CaptureReservation(id, hold); err != nil {
+		t.Fatalf("Capture failed: %v", err)
+	}
+	limits, err := user.ListLimits(id)
+	if err != nil || len(limits) != 1 || limits[0].Used != 1000 {
+		t.Errorf("Expected 10.00 of the wager limit used, got %+v (%v)", limits, err)
+	}
+}
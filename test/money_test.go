@@ -0,0 +1,92 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"entain-app/internal/user"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    user.Money
+		wantErr error
+	}{
+		{"10.15", 1015, nil},
+		{"10", 1000, nil},
+		{"0.1", 10, nil},
+		{".5", 50, nil},
+		{"12.340", 1234, nil}, // NUMERIC text may carry trailing zeros
+		{"-3.07", -307, nil},
+		{"9999999999.99", user.MaxMoney, nil},
+		{"10000000000.00", 0, user.ErrAmountOverflow},
+		{"10.123", 0, user.ErrAmountFormat},
+		{"1e3", 0, user.ErrAmountFormat},
+		{"10.", 0, user.ErrAmountFormat},
+		{"", 0, user.ErrAmountFormat},
+	}
+
+	for _, c := range cases {
+		got, err := user.ParseMoney(c.in)
+		if err != c.wantErr {
+			t.Errorf("ParseMoney(%q) error = %v, want %v", c.in, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", c.in, got, c.want)
+		}
+	}
+}
+
+func TestMoneyNoFloatDrift(t *testing.T) {
+	// One million 0.01 debits must land exactly on zero.
+	balance, _ := user.ParseMoney("10000.00")
+	cent, _ := user.ParseMoney("0.01")
+	for i := 0; i < 1_000_000; i++ {
+		balance, _ = balance.Sub(cent)
+	}
+	if balance != 0 || balance.String() != "0.00" {
+		t.Fatalf("expected exact zero balance, got %s", balance)
+	}
+}
+
+func TestMoneyOverflow(t *testing.T) {
+	if _, err := user.MaxMoney.Add(1); err != user.ErrAmountOverflow {
+		t.Fatalf("expected overflow at NUMERIC(12,2) limit, got %v", err)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(user.Money(-5))
+	if err != nil || string(data) != `"-0.05"` {
+		t.Fatalf("unexpected JSON %s (%v)", data, err)
+	}
+	var m user.Money
+	if err := json.Unmarshal([]byte(`"7.50"`), &m); err != nil || m != 750 {
+		t.Fatalf("unexpected decode %d (%v)", m, err)
+	}
+}
+
+func TestMoneyCurrencyPrecision(t *testing.T) {
+	cases := []struct {
+		in         user.Money
+		minorUnits int
+		want       string
+		fits       bool
+	}{
+		{in: 123456, minorUnits: 2, want: "1234.56", fits: true},
+		{in: 100000, minorUnits: 0, want: "1000", fits: true},
+		{in: 100050, minorUnits: 0, want: "1000", fits: false},
+		{in: -1500, minorUnits: 0, want: "-15", fits: true},
+		{in: 1230, minorUnits: 1, want: "12.3", fits: true},
+	}
+	for _, c := range cases {
+		if got := c.in.Format(c.minorUnits); got != c.want {
+			t.Errorf("Money(%d).Format(%d) = %q, want %q", c.in, c.minorUnits, got, c.want)
+		}
+		if got := c.in.FitsMinorUnits(c.minorUnits); got != c.fits {
+			t.Errorf("Money(%d).FitsMinorUnits(%d) = %v, want %v", c.in, c.minorUnits, got, c.fits)
+		}
+	}
+}
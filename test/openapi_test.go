@@ -0,0 +1,179 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"entain-app/api"
+	"entain-app/internal/server"
+	"entain-app/pkg/utils"
+)
+
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	// Step 1: Load the served document
+	doc, err := utils.LoadOpenAPI(api.OpenAPI)
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI document: %v", err)
+	}
+
+	// Step 2: Every route and method registered must be described
+	routes := 0
+	err = server.NewRouter().Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("Route %s has no methods", tpl)
+			return nil
+		}
+		for _, method := range methods {
+			routes++
+			item := doc.Paths.Value(tpl)
+			if item == nil || item.GetOperation(method) == nil {
+				t.Errorf("%s %s is missing from api/openapi.json", method, tpl)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk routes: %v", err)
+	}
+	if routes == 0 {
+		t.Fatal("Expected routes to check")
+	}
+
+	// Step 3: And the document describes no route that does not exist
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			req := httptest.NewRequest(method, strings.NewReplacer("{", "", "}", "").Replace(path), nil)
+			var match mux.RouteMatch
+			if !server.NewRouter().Match(req, &match) || match.MatchErr != nil {
+				t.Errorf("%s %s is documented but not routed", method, path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIRequestValidation(t *testing.T) {
+	// Step 1: Validate in front of a handler that only records being reached
+	validate, err := utils.NewOpenAPIValidator(api.OpenAPI)
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI document: %v", err)
+	}
+	handler := validate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     map[string]string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"valid transaction", "POST", "/user/1/transaction", map[string]string{"Source-Type": "Game"},
+			`{"state":"win","amount":"10.15","transactionId":"t1"}`, http.StatusTeapot, ""},
+		{"invalid user ID", "POST", "/user/abc/transaction", map[string]string{"Source-Type": "game"},
+			`{"state":"win","amount":"10"}`, http.StatusBadRequest, "Invalid user ID"},
+		{"zero user ID", "GET", "/user/0/balance", nil, "", http.StatusBadRequest, "Invalid user ID"},
+		{"missing source type", "POST", "/user/1/transaction", nil,
+			`{"state":"win","amount":"10"}`, http.StatusBadRequest, utils.InvalidSourceTypeMessage},
+		{"invalid source type", "POST", "/user/1/transaction", map[string]string{"Source-Type": "casino"},
+			`{"state":"win","amount":"10"}`, http.StatusBadRequest, utils.InvalidSourceTypeMessage},
+		{"invalid state", "POST", "/user/1/transaction", map[string]string{"Source-Type": "game"},
+			`{"state":"draw","amount":"10"}`, http.StatusBadRequest, utils.InvalidStateMessage},
+		{"invalid amount", "POST", "/user/1/transaction", map[string]string{"Source-Type": "game"},
+			`{"state":"win","amount":"10.155"}`, http.StatusBadRequest, utils.InvalidAmountMessage},
+		{"missing amount", "POST", "/user/1/transaction", map[string]string{"Source-Type": "game"},
+			`{"state":"win"}`, http.StatusBadRequest, "amount is required"},
+		{"malformed JSON", "POST", "/user/1/transaction", map[string]string{"Source-Type": "game"},
+			`{"state":`, http.StatusBadRequest, "Invalid JSON body"},
+		{"invalid history state", "GET", "/user/1/transactions?state=draw", nil, "",
+			http.StatusBadRequest, utils.InvalidStateMessage},
+		{"invalid history amount", "GET", "/user/1/transactions?minAmount=1.001", nil, "",
+			http.StatusBadRequest, "Invalid minAmount"},
+		{"missing bonus transaction ID", "POST", "/user/1/bonus", nil,
+			`{"amount":"5"}`, http.StatusBadRequest, "transactionId is required"},
+		{"invalid limit period", "DELETE", "/user/1/limits/deposit/yearly", nil, "", http.StatusBadRequest,
+			"Invalid limit: type must be 'deposit', 'loss' or 'wager' and period 'daily', 'weekly' or 'monthly'"},
+		{"invalid batch mode", "POST", "/transactions:batch", nil,
+			`{"mode":"all","items":[{"userId":1}]}`, http.StatusBadRequest, "Invalid mode: must be 'atomic' or 'best_effort'"},
+		{"empty batch", "POST", "/transactions:batch", nil,
+			`{"mode":"atomic","items":[]}`, http.StatusBadRequest, "Batch must have 1 to 1000 items"},
+		{"batch items left to the handler", "POST", "/transactions:batch", nil,
+			`{"mode":"best_effort","items":[{"userId":1,"state":"draw","amount":"1.001"}]}`, http.StatusTeapot, ""},
+		{"stream body left to the handler", "POST", "/transactions:stream", map[string]string{"Content-Type": "application/x-ndjson"},
+			"not json\n", http.StatusTeapot, ""},
+		{"invalid webhook ID", "GET", "/webhooks/x", nil, "", http.StatusBadRequest, "Invalid webhook ID"},
+		{"undocumented route", "GET", "/nowhere", nil, "", http.StatusTeapot, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantError == "" {
+				return
+			}
+			var body utils.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to decode error: %v", err)
+			}
+			if body.Error != tc.wantError {
+				t.Errorf("Expected error %q, got %q", tc.wantError, body.Error)
+			}
+		})
+	}
+}
+
+func TestOpenAPIMatchesValidators(t *testing.T) {
+	validate, err := utils.NewOpenAPIValidator(api.OpenAPI)
+	if err != nil {
+		t.Fatalf("Failed to load OpenAPI document: %v", err)
+	}
+	handler := validate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	accepts := func(sourceType, state, amount string) bool {
+		body, _ := json.Marshal(map[string]string{"state": state, "amount": amount})
+		req := httptest.NewRequest("POST", "/user/1/transaction", strings.NewReader(string(body)))
+		req.Header.Set("Source-Type", sourceType)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code == http.StatusOK
+	}
+
+	// The schema accepts exactly what the utils validators accept
+	for _, v := range []string{"game", "SERVER", "Payment", "casino", "gamer"} {
+		if got, want := accepts(v, "win", "1"), utils.IsValidSourceType(v); got != want {
+			t.Errorf("Source-Type %q: schema accepts=%v, IsValidSourceType=%v", v, got, want)
+		}
+	}
+	for _, v := range []string{"win", "lose", "WIN", "draw"} {
+		if got, want := accepts("game", v, "1"), utils.IsValidState(v); got != want {
+			t.Errorf("state %q: schema accepts=%v, IsValidState=%v", v, got, want)
+		}
+	}
+	for _, v := range []string{"10", "10.1", "10.15", "10.155", "1.2.3", ".5"} {
+		if got, want := accepts("game", "win", v), utils.IsValidAmountFormat(v); got != want {
+			t.Errorf("amount %q: schema accepts=%v, IsValidAmountFormat=%v", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestOutboxPublishesEventsInOrder(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker)
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("outbox_%d_", time.Now().UnixNano())
+
+	// Step 2: Two transactions and a reversal, then a rejected one that must not publish
+	for _, req := range []struct{ state, amount string }{{"win", "10.00"}, {"lose", "4.00"}} {
+		_, err := user.ProcessTransaction(id, user.TransactionRequest{
+			State: req.state, Amount: req.amount, TransactionID: prefix + req.state,
+		}, "game")
+		if err != nil {
+			t.Fatalf("Failed to process %s: %v", req.state, err)
+		}
+	}
+	if _, err := user.ReverseTransaction(id, prefix+"lose"); err != nil {
+		t.Fatalf("Failed to reverse: %v", err)
+	}
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{
+		State: "lose", Amount: "1000.00", TransactionID: prefix + "too_much",
+	}, "game"); err != user.ErrInsufficientBalance {
+		t.Fatalf("Expected insufficient balance, got %v", err)
+	}
+
+	// Step 3: Relay through a channel sink and collect this user's events
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := user.NewChannelSink(16)
+	user.StartOutboxRelay(ctx, sink)
+
+	var events []user.Event
+	timeout := time.After(30 * time.Second)
+	for len(events) < 3 {
+		select {
+		case e := <-sink.C:
+			if e.UserID == id {
+				events = append(events, e)
+			}
+		case <-timeout:
+			t.Fatalf("Timed out with %d of 3 events", len(events))
+		}
+	}
+
+	// Step 4: Events arrive in commit order with before/after balances
+	want := []struct {
+		typ, txID         string
+		previous, balance user.Money
+	}{
+		{user.EventTransactionProcessed, prefix + "win", 0, 1000},
+		{user.EventTransactionProcessed, prefix + "lose", 1000, 600},
+		{user.EventTransactionReversed, user.ReversalID(prefix + "lose"), 600, 1000},
+	}
+	for i, w := range want {
+		var p user.BalanceEvent
+		if err := json.Unmarshal(events[i].Payload, &p); err != nil {
+			t.Fatalf("Failed to decode payload: %v", err)
+		}
+		if events[i].Type != w.typ || p.TransactionID != w.txID || p.PreviousBalance != w.previous || p.Balance != w.balance {
+			t.Errorf("Event %d: expected %+v, got %s %+v", i, w, events[i].Type, p)
+		}
+		if i > 0 && events[i].ID <= events[i-1].ID {
+			t.Errorf("Event %d out of order: id %d after %d", i, events[i].ID, events[i-1].ID)
+		}
+	}
+
+	// Step 5: The file sink appends one JSON line per event
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	fileSink, err := user.NewFileSink(path)
+	if err != nil {
+		t.Fatalf("Failed to open file sink: %v", err)
+	}
+	for _, e := range events {
+		if err := fileSink.Publish(ctx, e); err != nil {
+			t.Fatalf("Failed to publish to file: %v", err)
+		}
+	}
+	fileSink.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open event file: %v", err)
+	}
+	defer f.Close()
+	var lines int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e user.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.ID != events[lines].ID {
+			t.Errorf("Line %d: expected event %d, got %s (%v)", lines, events[lines].ID, scanner.Text(), err)
+		}
+		lines++
+	}
+	if lines != len(events) {
+		t.Errorf("Expected %d lines, got %d", len(events), lines)
+	}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestReconcileReportsAndRepairsDrift(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and give a new account some history
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("recon_%d_", time.Now().UnixNano())
+	for i, req := range []user.TransactionRequest{
+		{State: "win", Amount: "20.00"},
+		{State: "lose", Amount: "5.50"},
+	} {
+		req.TransactionID = fmt.Sprintf("%s%d", prefix, i)
+		if _, err := user.ProcessTransaction(id, req, "game"); err != nil {
+			t.Fatalf("Failed to process transaction: %v", err)
+		}
+	}
+
+	findDrift := func(report *user.ReconciliationReport) *user.BalanceDrift {
+		for i := range report.Drifts {
+			if report.Drifts[i].UserID == id {
+				return &report.Drifts[i]
+			}
+		}
+		return nil
+	}
+
+	// Step 2: A consistent wallet reports no drift
+	report, err := user.Reconcile(false, "test")
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if d := findDrift(report); d != nil {
+		t.Fatalf("Expected no drift, got %+v", d)
+	}
+
+	// Step 3: Corrupt the balance behind the service's back; it is reported but not touched
+	if _, err := db.DB.Exec(`UPDATE wallets SET balance = balance + 1.25 WHERE user_id = $1`, id); err != nil {
+		t.Fatalf("Failed to corrupt balance: %v", err)
+	}
+	report, err = user.Reconcile(false, "test")
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	d := findDrift(report)
+	if d == nil || d.Balance != 1575 || d.Expected != 1450 || d.Ledger != 1450 || d.Drift != 125 || d.Repaired {
+		t.Fatalf("Expected unrepaired drift of 1.25 over 14.50, got %+v", d)
+	}
+
+	// Step 4: Repair restores the recomputed balance and records the correction
+	report, err = user.Reconcile(true, "test")
+	if err != nil {
+		t.Fatalf("Reconcile with repair failed: %v", err)
+	}
+	if d := findDrift(report); d == nil || !d.Repaired {
+		t.Fatalf("Expected drift to be repaired, got %+v", d)
+	}
+	balance, err := user.GetUserBalance(id)
+	if err != nil || balance.Balance != 1450 {
+		t.Errorf("Expected balance 14.50 after repair, got %+v (%v)", balance, err)
+	}
+	var corrections int
+	err = db.DB.QueryRow(`
+		SELECT COUNT(*) FROM balance_corrections
+		WHERE user_id = $1 AND previous_balance = 15.75 AND corrected_balance = 14.50 AND actor = 'test'`, id).Scan(&corrections)
+	if err != nil || corrections != 1 {
+		t.Errorf("Expected one recorded correction, got %d (%v)", corrections, err)
+	}
+}
+
+func TestRepairSurvivesLedgerRebuild(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and fund a new account
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	deposit := fmt.Sprintf("recon_ledger_%d", time.Now().UnixNano())
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{State: "win", Amount: "20.00", TransactionID: deposit}, "payment"); err != nil {
+		t.Fatalf("Deposit failed: %v", err)
+	}
+
+	// Step 2: Corrupt both legs of the deposit's entry and rebuild, so the ledger drifts along with the balance
+	_, err = db.DB.Exec(`
+		UPDATE postings SET amount = amount + 1.25
+		WHERE entry_id = (SELECT id FROM journal_entries WHERE transaction_id = $1)`, deposit)
+	if err != nil {
+		t.Fatalf("Failed to corrupt postings: %v", err)
+	}
+	if rebuilt, err := user.RebuildBalance(id, user.DefaultCurrency()); err != nil || rebuilt != 2125 {
+		t.Fatalf("Expected the corrupted ledger to rebuild to 21.25, got %s (%v)", rebuilt, err)
+	}
+
+	// Step 3: Repair brings the balance back to the transaction log through a correction entry
+	report, err := user.Reconcile(true, "test")
+	if err != nil {
+		t.Fatalf("Reconcile with repair failed: %v", err)
+	}
+	var drift *user.BalanceDrift
+	for i := range report.Drifts {
+		if report.Drifts[i].UserID == id {
+			drift = &report.Drifts[i]
+		}
+	}
+	if drift == nil || !drift.Repaired || drift.Expected != 2000 || drift.Ledger != 2125 {
+		t.Fatalf("Expected a repaired drift from ledger 21.25 to 20.00, got %+v", drift)
+	}
+	var corrections int
+	err = db.DB.QueryRow(`
+		SELECT COUNT(*) FROM postings p
+		JOIN ledger_accounts a ON a.id = p.account_id
+		WHERE a.code = $1 AND p.direction = 'credit' AND p.amount = 1.25`,
+		user.HouseAccount(user.AccountReconciliation, user.DefaultCurrency())).Scan(&corrections)
+	if err != nil || corrections == 0 {
+		t.Errorf("Expected a correction against the reconciliation account, got %d (%v)", corrections, err)
+	}
+
+	// Step 4: A ledger rebuild keeps the repaired balance, and the wallet no longer drifts
+	if rebuilt, err := user.RebuildBalance(id, user.DefaultCurrency()); err != nil || rebuilt != 2000 {
+		t.Errorf("Expected the rebuild to keep 20.00, got %s (%v)", rebuilt, err)
+	}
+	report, err = user.Reconcile(false, "test")
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	for _, d := range report.Drifts {
+		if d.UserID == id {
+			t.Errorf("Expected no drift after the repair, got %+v", d)
+		}
+	}
+}
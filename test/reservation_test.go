@@ -0,0 +1,138 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestReservationLifecycle(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and fund a new account
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("resv_%d_", time.Now().UnixNano())
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{State: "win", Amount: "10.00", TransactionID: prefix + "fund"}, "payment"); err != nil {
+		t.Fatalf("Failed to fund account: %v", err)
+	}
+	expectBalance := func(step string, balance, reserved user.Money) {
+		t.Helper()
+		b, err := user.GetUserBalance(id)
+		if err != nil || b.Balance != balance || b.Reserved != reserved {
+			t.Errorf("%s: expected balance %s with %s reserved, got %+v (%v)", step, balance, reserved, b, err)
+		}
+	}
+
+	// Step 2: Authorizing holds funds without changing the total
+	captured := prefix + "captured"
+	r, err := user.AuthorizeReservation(id, user.ReservationRequest{ReservationID: captured, Amount: "4.00"}, "game")
+	if err != nil || r.Status != user.ReservationHeld {
+		t.Fatalf("Authorize failed: %+v (%v)", r, err)
+	}
+	expectBalance("authorize", 1000, 400)
+
+	// Step 3: A client cannot take the ID the capture will get
+	_, err = user.ProcessTransaction(id, user.TransactionRequest{State: "lose", Amount: "1.00", TransactionID: user.CaptureID(captured)}, "game")
+	if err != user.ErrReservedTransactionID {
+		t.Errorf("Expected a reserved capture ID to be rejected, got %v", err)
+	}
+
+	// Step 4: Capturing debits the hold; capturing again replays it
+	result, err := user.CaptureReservation(id, captured)
+	if err != nil || result.TransactionID != user.CaptureID(captured) || result.Replayed {
+		t.Fatalf("Capture failed: %+v (%v)", result, err)
+	}
+	expectBalance("capture", 600, 0)
+	result, err = user.CaptureReservation(id, captured)
+	if err != nil || !result.Replayed || result.Balance == nil || *result.Balance != 600 {
+		t.Errorf("Expected the capture to replay with balance 6.00, got %+v (%v)", result, err)
+	}
+	expectBalance("second capture", 600, 0)
+
+	// Step 5: Releasing returns the funds, and a released hold cannot be captured
+	released := prefix + "released"
+	if _, err := user.AuthorizeReservation(id, user.ReservationRequest{ReservationID: released, Amount: "2.00"}, "game"); err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	r, err = user.ReleaseReservation(id, released)
+	if err != nil || r.Status != user.ReservationReleased {
+		t.Errorf("Release failed: %+v (%v)", r, err)
+	}
+	expectBalance("release", 600, 0)
+	if _, err := user.CaptureReservation(id, released); err != user.ErrReservationNotHeld {
+		t.Errorf("Expected a released hold not to capture, got %v", err)
+	}
+
+	// Step 6: A hold past its TTL cannot be captured and is swept as expired
+	expired := prefix + "expired"
+	if _, err := user.AuthorizeReservation(id, user.ReservationRequest{ReservationID: expired, Amount: "3.00", TTLSeconds: 1}, "game"); err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := user.CaptureReservation(id, expired); err != user.ErrReservationExpired {
+		t.Errorf("Expected an expired hold not to capture, got %v", err)
+	}
+	if _, err := user.ExpireReservations(); err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	r, err = user.GetReservation(id, expired)
+	if err != nil || r.Status != user.ReservationExpired {
+		t.Errorf("Expected the hold to be expired, got %+v (%v)", r, err)
+	}
+	expectBalance("expiry", 600, 0)
+}
+
+func TestWithdrawalHoldKeepsItsCash(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and fund a new account with 50.00 cash and a 50.00 bonus
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("heldcash_%d_", time.Now().UnixNano())
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{State: "win", Amount: "50.00", TransactionID: prefix + "fund"}, "payment"); err != nil {
+		t.Fatalf("Failed to fund account: %v", err)
+	}
+	if _, err := user.GrantBonus(id, user.BonusRequest{TransactionID: prefix + "bonus", Amount: "50.00", WageringRequirement: "500.00"}); err != nil {
+		t.Fatalf("Failed to grant bonus: %v", err)
+	}
+
+	// Step 2: A withdrawal hold takes all of the cash
+	hold := prefix + "hold"
+	if _, err := user.AuthorizeReservation(id, user.ReservationRequest{ReservationID: hold, Amount: "50.00"}, "payment"); err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+
+	// Step 3: Neither a second hold nor a withdrawal can spend the held cash
+	_, err = user.AuthorizeReservation(id, user.ReservationRequest{ReservationID: prefix + "hold2", Amount: "1.00"}, "payment")
+	if err != user.ErrInsufficientCash {
+		t.Errorf("Expected a second withdrawal hold to be rejected, got %v", err)
+	}
+	_, err = user.ProcessTransaction(id, user.TransactionRequest{State: "lose", Amount: "50.00", TransactionID: prefix + "withdraw"}, "payment")
+	if err != user.ErrInsufficientCash {
+		t.Errorf("Expected a withdrawal of held cash to be rejected, got %v", err)
+	}
+
+	// Step 4: The hold still captures, leaving only the bonus
+	if _, err := user.CaptureReservation(id, hold); err != nil {
+		t.Fatalf("Capture failed: %v", err)
+	}
+	wallets, err := user.ListWallets(id, "")
+	if err != nil || len(wallets) != 1 {
+		t.Fatalf("Expected 1 wallet, got %d (%v)", len(wallets), err)
+	}
+	if w := wallets[0]; w.Balance != 5000 || w.Bonus != 5000 || w.Reserved != 0 || w.ReservedCash != 0 {
+		t.Errorf("Expected 50.00 of bonus and nothing held, got %+v", w)
+	}
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestReversalIsSingleUseAndFinal(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and apply a deposit and a bet
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("rev_%d_", time.Now().UnixNano())
+	deposit, bet := prefix+"deposit", prefix+"bet"
+
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{State: "win", Amount: "20.00", TransactionID: deposit}, "payment"); err != nil {
+		t.Fatalf("Deposit failed: %v", err)
+	}
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{State: "lose", Amount: "5.00", TransactionID: bet}, "game"); err != nil {
+		t.Fatalf("Bet failed: %v", err)
+	}
+
+	// Step 2: A client cannot take the ID the reversal of the deposit will get
+	_, err = user.ProcessTransaction(id, user.TransactionRequest{State: "lose", Amount: "1.00", TransactionID: user.ReversalID(deposit)}, "game")
+	if err != user.ErrReservedTransactionID {
+		t.Errorf("Expected a reserved reversal ID to be rejected, got %v", err)
+	}
+	_, err = user.GrantBonus(id, user.BonusRequest{TransactionID: user.ReversalID(deposit), Amount: "1.00"})
+	if err != user.ErrReservedTransactionID {
+		t.Errorf("Expected a reserved bonus ID to be rejected, got %v", err)
+	}
+
+	// Step 3: Reversing the bet puts the stake back under the reversal ID
+	result, err := user.ReverseTransaction(id, bet)
+	if err != nil {
+		t.Fatalf("Reversal failed: %v", err)
+	}
+	if result.TransactionID != user.ReversalID(bet) || result.Balance == nil || *result.Balance != 2000 {
+		t.Errorf("Expected %s with balance 20.00, got %+v", user.ReversalID(bet), result)
+	}
+
+	// Step 4: The bet cannot be reversed twice, nor the reversal itself
+	if _, err := user.ReverseTransaction(id, bet); err != user.ErrAlreadyReversed {
+		t.Errorf("Expected a second reversal to be rejected, got %v", err)
+	}
+	if _, err := user.ReverseTransaction(id, user.ReversalID(bet)); err != user.ErrNotReversible {
+		t.Errorf("Expected the reversal to be final, got %v", err)
+	}
+
+	// Step 5: The deposit, whose reversal ID a client tried to take, still reverses
+	result, err = user.ReverseTransaction(id, deposit)
+	if err != nil || result.Balance == nil || *result.Balance != 0 {
+		t.Errorf("Expected the deposit reversal to leave 0.00, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestRoundSettlementRetryAndReversal(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and fund a new account
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("round_%d_", time.Now().UnixNano())
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{State: "win", Amount: "10.00", TransactionID: prefix + "fund"}, "payment"); err != nil {
+		t.Fatalf("Failed to fund account: %v", err)
+	}
+
+	// Step 2: Stake into a round and settle it with a win
+	roundID := prefix + "r1"
+	bet := user.TransactionRequest{State: "lose", Amount: "2.00", TransactionID: prefix + "bet", RoundID: roundID, GameID: "slots"}
+	win := user.TransactionRequest{State: "win", Amount: "5.00", TransactionID: prefix + "win", RoundID: roundID}
+	if _, err := user.ProcessTransaction(id, bet, "game"); err != nil {
+		t.Fatalf("Bet failed: %v", err)
+	}
+	if _, err := user.ProcessTransaction(id, win, "game"); err != nil {
+		t.Fatalf("Win failed: %v", err)
+	}
+
+	// Step 3: Retrying the win replays it although the round is now settled
+	result, err := user.ProcessTransaction(id, win, "game")
+	if err != nil || !result.Replayed || result.Balance == nil || *result.Balance != 1300 {
+		t.Errorf("Expected the win to replay with balance 13.00, got %+v (%v)", result, err)
+	}
+
+	// Step 4: A new win on the settled round is still rejected
+	_, err = user.ProcessTransaction(id, user.TransactionRequest{State: "win", Amount: "1.00", TransactionID: prefix + "win2", RoundID: roundID}, "game")
+	if err != user.ErrRoundNotOpen {
+		t.Errorf("Expected a win on a settled round to be rejected, got %v", err)
+	}
+	round, err := user.GetRound(id, roundID)
+	if err != nil || round.Stake != 200 || round.Payout != 500 || round.Status != user.RoundSettled {
+		t.Errorf("Expected a settled round with stake 2.00 and payout 5.00, got %+v (%v)", round, err)
+	}
+
+	// Step 5: Reversing the bet takes the stake back off the round
+	if _, err := user.ReverseTransaction(id, bet.TransactionID); err != nil {
+		t.Fatalf("Reversal failed: %v", err)
+	}
+	round, err = user.GetRound(id, roundID)
+	if err != nil || round.Stake != 0 || round.Net != 500 || round.Status != user.RoundSettled {
+		t.Errorf("Expected stake 0.00 and net 5.00 after the reversal, got %+v (%v)", round, err)
+	}
+	stored, err := user.GetTransaction(id, user.ReversalID(bet.TransactionID))
+	if err != nil || stored.RoundID != roundID {
+		t.Errorf("Expected the reversal to be linked to %s, got %+v (%v)", roundID, stored, err)
+	}
+}
+
+func TestPlayersShareAProviderRoundID(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and fund two new accounts
+	db.InitDB()
+	db.RunMigrations()
+
+	prefix := fmt.Sprintf("table_%d_", time.Now().UnixNano())
+	roundID := prefix + "r1"
+	var ids [2]uint64
+	for i := range ids {
+		account, err := user.CreateAccount()
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+		ids[i] = account.UserID
+		_, err = user.ProcessTransaction(ids[i], user.TransactionRequest{
+			State: "win", Amount: "10.00", TransactionID: fmt.Sprintf("%sfund_%d", prefix, i),
+		}, "payment")
+		if err != nil {
+			t.Fatalf("Failed to fund account: %v", err)
+		}
+	}
+
+	// Step 2: Both players stake into the same provider round
+	for i, id := range ids {
+		_, err := user.ProcessTransaction(id, user.TransactionRequest{
+			State: "lose", Amount: fmt.Sprintf("%d.00", i+1), TransactionID: fmt.Sprintf("%sbet_%d", prefix, i), RoundID: roundID,
+		}, "game")
+		if err != nil {
+			t.Fatalf("Player %d failed to join the round: %v", i, err)
+		}
+	}
+
+	// Step 3: Settling one player's round leaves the other's open
+	_, err := user.ProcessTransaction(ids[0], user.TransactionRequest{
+		State: "win", Amount: "4.00", TransactionID: prefix + "win_0", RoundID: roundID,
+	}, "game")
+	if err != nil {
+		t.Fatalf("Settlement failed: %v", err)
+	}
+	first, err := user.GetRound(ids[0], roundID)
+	if err != nil || first.Status != user.RoundSettled || first.Stake != 100 || first.Payout != 400 {
+		t.Errorf("Expected the first player's round settled with stake 1.00 and payout 4.00, got %+v (%v)", first, err)
+	}
+	second, err := user.GetRound(ids[1], roundID)
+	if err != nil || second.Status != user.RoundOpen || second.Stake != 200 || second.Payout != 0 {
+		t.Errorf("Expected the second player's round open with stake 2.00, got %+v (%v)", second, err)
+	}
+
+	// Step 4: Reversing the second player's stake only touches their round
+	if _, err := user.ReverseTransaction(ids[1], fmt.Sprintf("%sbet_1", prefix)); err != nil {
+		t.Fatalf("Reversal failed: %v", err)
+	}
+	first, _ = user.GetRound(ids[0], roundID)
+	second, _ = user.GetRound(ids[1], roundID)
+	if first.Stake != 100 || second.Stake != 0 {
+		t.Errorf("Expected stakes 1.00 and 0.00, got %s and %s", first.Stake, second.Stake)
+	}
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestHandleTransactionStream(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker)
+	db.InitDB()
+	db.RunMigrations()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/transactions:stream", user.HandleTransactionStream)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// Step 2: Upload a valid line, a broken one, a blank one and a replay of the first
+	txID := fmt.Sprintf("stream_%d", time.Now().UnixNano())
+	line := fmt.Sprintf(`{"userId":1, "state":"win", "amount":"1.00", "transactionId":%q}`, txID)
+	body := line + "\n{not json\n\n" + line + "\n"
+
+	req, _ := http.NewRequest("POST", ts.URL+"/transactions:stream", strings.NewReader(body))
+	req.Header.Set("Source-Type", "game")
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to call endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Step 3: One result line per input line, in order
+	var results []user.StreamResult
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var res user.StreamResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			t.Fatalf("Failed to parse result line %q: %v", scanner.Text(), err)
+		}
+		results = append(results, res)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 result lines, got %d", len(results))
+	}
+	if results[0].Line != 1 || results[0].Status != http.StatusOK || results[0].Replayed {
+		t.Errorf("Expected line 1 applied, got %+v", results[0])
+	}
+	if results[1].Line != 2 || results[1].Status != http.StatusBadRequest {
+		t.Errorf("Expected line 2 rejected, got %+v", results[1])
+	}
+	if results[2].Line != 4 || results[2].Status != http.StatusOK || !results[2].Replayed {
+		t.Errorf("Expected line 4 replayed, got %+v", results[2])
+	}
+}
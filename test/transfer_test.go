@@ -0,0 +1,92 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestTransfersAreAtomicAndIdempotent(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and fund two new accounts
+	db.InitDB()
+	db.RunMigrations()
+
+	prefix := fmt.Sprintf("xfer_%d_", time.Now().UnixNano())
+	var ids [2]uint64
+	for i := range ids {
+		account, err := user.CreateAccount()
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+		ids[i] = account.UserID
+		_, err = user.ProcessTransaction(ids[i], user.TransactionRequest{
+			State: "win", Amount: "100.00", TransactionID: fmt.Sprintf("%sfund_%d", prefix, i),
+		}, "payment")
+		if err != nil {
+			t.Fatalf("Failed to fund account: %v", err)
+		}
+	}
+
+	// Step 2: Transfer back and forth concurrently; lock ordering must avoid deadlocks
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		from, to := ids[i%2], ids[(i+1)%2]
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := user.CreateTransfer(user.TransferRequest{
+				TransferID: fmt.Sprintf("%s%d", prefix, i), FromUserID: from, ToUserID: to, Amount: "1.00",
+			})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Transfer failed: %v", err)
+		}
+	}
+
+	// Step 3: Replaying a transfer changes nothing; reusing its ID for another payload conflicts
+	replay, err := user.CreateTransfer(user.TransferRequest{TransferID: prefix + "0", FromUserID: ids[0], ToUserID: ids[1], Amount: "1.00"})
+	if err != nil || !replay.Replayed {
+		t.Errorf("Expected replay of transfer, got %+v (%v)", replay, err)
+	}
+	_, err = user.CreateTransfer(user.TransferRequest{TransferID: prefix + "0", FromUserID: ids[0], ToUserID: ids[1], Amount: "2.00"})
+	if err != user.ErrTransferConflict {
+		t.Errorf("Expected transfer conflict, got %v", err)
+	}
+
+	// Step 4: A client cannot take the ID of a leg ahead of its transfer
+	_, err = user.ProcessTransaction(ids[0], user.TransactionRequest{
+		State: "lose", Amount: "1.00", TransactionID: user.TransferDebitID(prefix + "squat"),
+	}, "payment")
+	if err != user.ErrReservedTransactionID {
+		t.Errorf("Expected a reserved transfer ID to be rejected, got %v", err)
+	}
+	_, err = user.CreateTransfer(user.TransferRequest{TransferID: prefix + "squat", FromUserID: ids[0], ToUserID: ids[1], Amount: "1.00"})
+	if err != nil {
+		t.Errorf("Expected the transfer to go through, got %v", err)
+	}
+	_, err = user.CreateTransfer(user.TransferRequest{TransferID: prefix + "squat_back", FromUserID: ids[1], ToUserID: ids[0], Amount: "1.00"})
+	if err != nil {
+		t.Errorf("Expected the transfer back to go through, got %v", err)
+	}
+
+	// Step 5: Eleven transfers each way leave both balances unchanged
+	for _, id := range ids {
+		balance, err := user.GetUserBalance(id)
+		if err != nil {
+			t.Fatalf("Failed to fetch balance: %v", err)
+		}
+		if balance.Balance != 10000 {
+			t.Errorf("Expected user %d balance 100.00, got %s", id, balance.Balance)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestMultiCurrencyWallets(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker) and fund a new account in the default currency
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+	prefix := fmt.Sprintf("fx_%d_", time.Now().UnixNano())
+	txn := func(req user.TransactionRequest, sourceType string) error {
+		req.TransactionID = prefix + req.TransactionID
+		_, err := user.ProcessTransaction(id, req, sourceType)
+		return err
+	}
+	if err := txn(user.TransactionRequest{State: "win", Amount: "10.00", TransactionID: "deposit"}, "payment"); err != nil {
+		t.Fatalf("Deposit failed: %v", err)
+	}
+
+	// Step 2: Currencies without a wallet, or unknown ones, are rejected
+	if err := txn(user.TransactionRequest{State: "win", Amount: "1000", TransactionID: "early", Currency: "JPY"}, "payment"); err != user.ErrWalletNotFound {
+		t.Errorf("Expected a missing wallet to be rejected, got %v", err)
+	}
+	if err := txn(user.TransactionRequest{State: "win", Amount: "1.00", TransactionID: "unknown", Currency: "XYZ"}, "payment"); err != user.ErrUnsupportedCurrency {
+		t.Errorf("Expected an unknown currency to be rejected, got %v", err)
+	}
+
+	// Step 3: Opening a wallet is idempotent
+	if _, created, err := user.OpenWallet(id, "jpy"); err != nil || !created {
+		t.Fatalf("Expected the JPY wallet to be opened, got %v (%v)", created, err)
+	}
+	if _, created, err := user.OpenWallet(id, "JPY"); err != nil || created {
+		t.Errorf("Expected the JPY wallet to exist already, got %v (%v)", created, err)
+	}
+
+	// Step 4: Amounts must fit the currency, and each wallet keeps its own balance
+	if err := txn(user.TransactionRequest{State: "win", Amount: "10.50", TransactionID: "fraction", Currency: "JPY"}, "payment"); err != user.ErrAmountPrecision {
+		t.Errorf("Expected fractional yen to be rejected, got %v", err)
+	}
+	if err := txn(user.TransactionRequest{State: "win", Amount: "1000", TransactionID: "yen", Currency: "JPY"}, "payment"); err != nil {
+		t.Fatalf("JPY deposit failed: %v", err)
+	}
+	yen, _ := user.ParseMoney("1000")
+	wallets, err := user.ListWallets(id, "")
+	if err != nil || len(wallets) != 2 {
+		t.Fatalf("Expected 2 wallets, got %d (%v)", len(wallets), err)
+	}
+	for _, w := range wallets {
+		want := user.Money(1000)
+		if w.Currency == "JPY" {
+			want = yen
+		}
+		if w.Balance != want {
+			t.Errorf("Expected the %s wallet to hold %s, got %s", w.Currency, want, w.Balance)
+		}
+	}
+
+	// Step 5: A round stays in the currency of its first stake
+	roundID := prefix + "r1"
+	if err := txn(user.TransactionRequest{State: "lose", Amount: "2.00", TransactionID: "bet", RoundID: roundID}, "game"); err != nil {
+		t.Fatalf("Bet failed: %v", err)
+	}
+	err = txn(user.TransactionRequest{State: "win", Amount: "500", TransactionID: "payout", RoundID: roundID, Currency: "JPY"}, "game")
+	if err != user.ErrRoundCurrency {
+		t.Errorf("Expected a payout in another currency to be rejected, got %v", err)
+	}
+
+	// Step 6: Each wallet has its own ledger account, and rebuilds per currency
+	for currency, want := range map[string]user.Money{user.DefaultCurrency(): 800, "JPY": yen} {
+		var got string
+		err := db.DB.QueryRow(`SELECT currency FROM ledger_accounts WHERE code = $1`, user.WalletAccount(id, currency)).Scan(&got)
+		if err != nil || got != currency {
+			t.Errorf("Expected a %s ledger account, got %q (%v)", currency, got, err)
+		}
+		if rebuilt, err := user.RebuildBalance(id, currency); err != nil || rebuilt != want {
+			t.Errorf("Expected the %s rebuild to give %s, got %s (%v)", currency, want, rebuilt, err)
+		}
+	}
+}
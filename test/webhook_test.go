@@ -0,0 +1,136 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"entain-app/internal/db"
+	"entain-app/internal/user"
+)
+
+func TestWebhookSignedDeliveryWithRetry(t *testing.T) {
+	// Step 1: Connect to DB (real one via docker)
+	db.InitDB()
+	db.RunMigrations()
+
+	account, err := user.CreateAccount()
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	id := account.UserID
+
+	// Step 2: A subscriber that checks signatures and fails its first request
+	var (
+		mu       sync.Mutex
+		secret   string
+		requests int
+		received []user.WebhookPayload
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get("Webhook-Timestamp"), 10, 64)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Webhook-Signature") != user.SignWebhook(secret, ts, body) {
+			t.Errorf("Bad signature %q", r.Header.Get("Webhook-Signature"))
+		}
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p user.WebhookPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+		received = append(received, p)
+	}))
+	defer server.Close()
+
+	// Step 3: Subscribe to transactions and a 5.00 threshold for this user
+	webhook, err := user.CreateWebhook(user.WebhookRequest{
+		URL:       server.URL,
+		Events:    []string{user.EventTransactionProcessed, user.EventBalanceThresholdCrossed},
+		UserID:    id,
+		Threshold: "5.00",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	defer user.DeleteWebhook(webhook.ID)
+	mu.Lock()
+	secret = webhook.Secret
+	mu.Unlock()
+
+	if _, err := user.CreateWebhook(user.WebhookRequest{
+		URL: server.URL, Events: []string{user.EventBalanceThresholdCrossed},
+	}); err != user.ErrWebhookThreshold {
+		t.Errorf("Expected ErrWebhookThreshold, got %v", err)
+	}
+
+	// Step 4: A win that crosses the threshold yields two deliveries
+	txID := "webhook_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if _, err := user.ProcessTransaction(id, user.TransactionRequest{
+		State: "win", Amount: "10.00", TransactionID: txID,
+	}, "game"); err != nil {
+		t.Fatalf("Failed to process transaction: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	user.StartOutboxRelay(ctx, user.WebhookSink{})
+	user.StartWebhookWorkers(ctx)
+
+	// Step 5: Both end up delivered, one of them after a retry
+	var deliveries []user.WebhookDelivery
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		deliveries, _, err = user.ListWebhookDeliveries(webhook.ID, user.DeliveryDelivered, "", 0)
+		if err != nil {
+			t.Fatalf("Failed to list deliveries: %v", err)
+		}
+		if len(deliveries) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out with %d of 2 deliveries delivered", len(deliveries))
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	attempts := 0
+	for _, d := range deliveries {
+		attempts += d.Attempts
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts in total, got %d", attempts)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	types := map[string]bool{}
+	for _, p := range received {
+		types[p.Type] = true
+		if p.UserID != id {
+			t.Errorf("Expected user %d, got %d", id, p.UserID)
+		}
+		if p.Type == user.EventBalanceThresholdCrossed {
+			data, _ := json.Marshal(p.Data)
+			var crossed user.ThresholdCrossedEvent
+			if err := json.Unmarshal(data, &crossed); err != nil || crossed.Direction != "above" || crossed.Balance != 1000 {
+				t.Errorf("Unexpected threshold event %s (%v)", data, err)
+			}
+		}
+	}
+	if !types[user.EventTransactionProcessed] || !types[user.EventBalanceThresholdCrossed] {
+		t.Errorf("Expected both event types, got %v", types)
+	}
+}